@@ -3,12 +3,17 @@ package sqlbp
 import (
 	"context"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 )
 
 type BaseDao struct {
-	tableName   string // 表名
-	dbName      string // 主库连接名
-	slaveDbName string // 从库连接名（没设置则查询使用主库）
+	tableName         string              // 表名
+	dbName            string              // 主库连接名
+	slaveDbName       string              // 从库连接名（没设置则查询使用主库）
+	logicDelete       *logicDeleteConfig  // 逻辑删除的设置（没设置则为物理删除）
+	metaObjectHandler MetaObjectHandler   // 字段自动填充处理器（没设置则使用全局的处理器）
+	fillColumns       map[string][]string // 可自动填充的字段，key为填充类型
+	interceptors      []Interceptor       // 拦截器，在全局的拦截器之后执行
 }
 
 func (dao *BaseDao) SetTableName(table string) {
@@ -50,6 +55,9 @@ func (dao *BaseDao) Insert(
 	ctx context.Context,
 	data interface{},
 ) (lastId int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "Insert", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
 	err = dao.CheckDao()
 	if err != nil {
 		return
@@ -59,19 +67,210 @@ func (dao *BaseDao) Insert(
 	if err != nil {
 		return
 	}
+	dataItems, err = fillDataItems(ctx, dao, FillInsert, data, dataItems)
+	if err != nil {
+		return
+	}
 
 	w := GetWrapper()
 	w.dataItems = dataItems
 	return insertByWrapper(ctx, dao, w)
 }
 
+// InsertBatch 批量插入数据，list为结构体或map的切片，生成 insert into t (cols) values (...), (...)
+// 数据会按opts分批插入，每一行的字段必须一致，返回影响的总行数与每一批的第一个自增ID
+// 注意：分批执行并不是原子的，如需保证原子性，请在ctx中设置事务
+func (dao *BaseDao) InsertBatch(
+	ctx context.Context,
+	list interface{},
+	opts *BatchOptions,
+) (result BatchResult, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "InsertBatch", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	data, err := toBatchRows(ctx, dao, list, "", FillInsert)
+	if err != nil {
+		return
+	}
+	return insertBatch(ctx, dao, modeInsert, data, opts)
+}
+
+// Upsert 插入数据，唯一键冲突时更新updateColumns中的字段为插入的值（即 `col` = values(`col`)）
+// updateColumns为空时更新除主键与只在插入时填充的字段之外所有插入的字段，返回值与MySQL一致：插入返回1，更新返回2，没有变化返回0
+func (dao *BaseDao) Upsert(
+	ctx context.Context,
+	data interface{},
+	updateColumns ...string,
+) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "Upsert", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	result, err := dao.UpsertBatch(ctx, []interface{}{data}, nil, updateColumns...)
+	return result.RowsAffected, err
+}
+
+// UpsertByWrapper 插入数据，唯一键冲突时按update中Set、SetExp与SetValues设置的内容更新
+// example: UpsertByWrapper(ctx, data, GetWrapper().SetValues("name").SetExp("times", "times + 1"))
+func (dao *BaseDao) UpsertByWrapper(
+	ctx context.Context,
+	data interface{},
+	update *Wrapper,
+) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "UpsertByWrapper", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	result, err := dao.UpsertBatchByWrapper(ctx, []interface{}{data}, nil, update)
+	return result.RowsAffected, err
+}
+
+// UpsertBatch 批量插入数据，唯一键冲突时更新updateColumns中的字段，详情请参考Upsert与InsertBatch
+func (dao *BaseDao) UpsertBatch(
+	ctx context.Context,
+	list interface{},
+	opts *BatchOptions,
+	updateColumns ...string,
+) (result BatchResult, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "UpsertBatch", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	return dao.upsertBatch(ctx, list, opts, updateColumns, nil)
+}
+
+// UpsertBatchByWrapper 批量插入数据，唯一键冲突时按update的设置更新，详情请参考UpsertByWrapper与InsertBatch
+func (dao *BaseDao) UpsertBatchByWrapper(
+	ctx context.Context,
+	list interface{},
+	opts *BatchOptions,
+	update *Wrapper,
+) (result BatchResult, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "UpsertBatchByWrapper", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	if update == nil {
+		err = fmt.Errorf("upsert update wrapper is nil")
+		return
+	}
+	return dao.upsertBatch(ctx, list, opts, nil, update)
+}
+
+func (dao *BaseDao) upsertBatch(
+	ctx context.Context,
+	list interface{},
+	opts *BatchOptions,
+	updateColumns []string,
+	update *Wrapper,
+) (result BatchResult, err error) {
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	data, err := toBatchRows(ctx, dao, list, "", FillInsert)
+	if err != nil {
+		return
+	}
+	items, err := interfaceToSlice(list)
+	if err != nil || len(items) == 0 {
+		return
+	}
+	insertFill, err := getFillColumns(dao, items[0], FillInsert)
+	if err != nil {
+		return
+	}
+	excludes := []string{getDataIdKey(items[0])}
+	for column := range insertFill {
+		excludes = append(excludes, column)
+	}
+	mode, err := newUpsertMode(data.columns, excludes, updateColumns, update)
+	if err != nil {
+		return
+	}
+	return insertBatch(ctx, dao, mode, data, opts)
+}
+
+// InsertIgnore 插入数据，唯一键冲突时忽略（insert ignore into），被忽略时返回0
+func (dao *BaseDao) InsertIgnore(
+	ctx context.Context,
+	data interface{},
+) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "InsertIgnore", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	result, err := dao.InsertIgnoreBatch(ctx, []interface{}{data}, nil)
+	return result.RowsAffected, err
+}
+
+// InsertIgnoreBatch 批量插入数据，唯一键冲突的行会被忽略，详情请参考InsertBatch
+func (dao *BaseDao) InsertIgnoreBatch(
+	ctx context.Context,
+	list interface{},
+	opts *BatchOptions,
+) (result BatchResult, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "InsertIgnoreBatch", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	data, err := toBatchRows(ctx, dao, list, "", FillInsert)
+	if err != nil {
+		return
+	}
+	return insertBatch(ctx, dao, modeInsertIgnore, data, opts)
+}
+
+// Replace 插入数据，唯一键冲突时先删除旧记录再插入（replace into），替换时返回2
+func (dao *BaseDao) Replace(
+	ctx context.Context,
+	data interface{},
+) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "Replace", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	result, err := dao.ReplaceBatch(ctx, []interface{}{data}, nil)
+	return result.RowsAffected, err
+}
+
+// ReplaceBatch 批量替换数据，详情请参考Replace与InsertBatch
+func (dao *BaseDao) ReplaceBatch(
+	ctx context.Context,
+	list interface{},
+	opts *BatchOptions,
+) (result BatchResult, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "ReplaceBatch", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	data, err := toBatchRows(ctx, dao, list, "", FillInsert)
+	if err != nil {
+		return
+	}
+	return insertBatch(ctx, dao, modeReplace, data, opts)
+}
+
 // UpdateById 更新数据
+// data中有 `sqlbp:"version"` 标签的字段时使用乐观锁：where中加上 version = 当前值，同时 version = version + 1，
+// 没有更新到记录时返回 ErrOptimisticLock，更新成功后会将data（指针）中的版本号加1
 func (dao *BaseDao) UpdateById(
 	ctx context.Context,
 	data interface{},
 	idKey string,
 	id interface{},
 ) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "UpdateById", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
 	err = dao.CheckDao()
 	if err != nil {
 		return
@@ -82,17 +281,87 @@ func (dao *BaseDao) UpdateById(
 	if err != nil {
 		return
 	}
+	dataItems, err = withoutInsertFill(dao, data, dataItems)
+	if err != nil {
+		return
+	}
+	dataItems, err = fillDataItems(ctx, dao, FillUpdate, data, dataItems)
+	if err != nil {
+		return
+	}
 
 	w.queryInfo.where = []whereItem{createWhereItem(idKey, "=", id)}
 	w.dataItems = dataItems
+
+	// 实体中有版本号字段时使用乐观锁更新
+	version, err := getVersionField(data)
+	if err != nil {
+		return
+	}
+	if version != nil {
+		return updateWithVersion(ctx, dao, w, version)
+	}
 	return updateByWrapper(ctx, dao, w)
 }
 
+// UpdateBatchById 按主键批量更新，每一行更新为各自的值，list为结构体或map的切片
+// columns为需要更新的字段，为空时更新除主键外的所有字段，生成：
+// update t set col = case id when ? then ? ... end where id in (...)
+// 数据会按opts分批更新，可以通过opts.Transaction让所有批次在同一个事务中执行
+func (dao *BaseDao) UpdateBatchById(
+	ctx context.Context,
+	list interface{},
+	idKey string,
+	opts *BatchOptions,
+	columns ...string,
+) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "UpdateBatchById", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	data, err := toBatchRows(ctx, dao, list, "", "")
+	if err != nil {
+		return
+	}
+	// 不允许通过更新修改租户字段
+	tenantColumn, _, err := getTenant(ctx, dao.GetTableName())
+	if err != nil {
+		return
+	}
+	if len(columns) == 0 {
+		columns = data.columns
+	}
+	updateColumns := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if column != idKey && column != tenantColumn {
+			updateColumns = append(updateColumns, column)
+		}
+	}
+	columns = updateColumns
+	if len(columns) == 0 {
+		err = fmt.Errorf("update data is not allow empty")
+		return
+	}
+
+	data, err = data.pick(append([]string{idKey}, columns...))
+	if err != nil {
+		return
+	}
+	return updateBatchById(ctx, dao, data, opts)
+}
+
 // UpdateByWrapper 更新数据
 func (dao *BaseDao) UpdateByWrapper(
 	ctx context.Context,
 	w *Wrapper,
 ) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "UpdateByWrapper", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
 	err = dao.CheckDao()
 	if err != nil {
 		return
@@ -102,15 +371,25 @@ func (dao *BaseDao) UpdateByWrapper(
 	if err != nil {
 		return
 	}
-	return updateByWrapper(ctx, dao, w)
+
+	dataItems, err := fillDataItems(ctx, dao, FillUpdate, nil, w.dataItems)
+	if err != nil {
+		return
+	}
+	update := *w
+	update.dataItems = dataItems
+	return updateByWrapper(ctx, dao, &update)
 }
 
-// DeleteById 删除数据
+// DeleteById 删除数据，开启了逻辑删除时转为更新逻辑删除字段
 func (dao *BaseDao) DeleteById(
 	ctx context.Context,
 	idKey string,
 	id interface{},
 ) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "DeleteById", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
 	err = dao.CheckDao()
 	if err != nil {
 		return
@@ -121,11 +400,14 @@ func (dao *BaseDao) DeleteById(
 	return deleteByWrapper(ctx, dao, w)
 }
 
-// DeleteByWrapper 更新数据
+// DeleteByWrapper 删除数据，开启了逻辑删除时转为更新逻辑删除字段
 func (dao *BaseDao) DeleteByWrapper(
 	ctx context.Context,
 	w *Wrapper,
 ) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "DeleteByWrapper", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
 	err = dao.CheckDao()
 	if err != nil {
 		return
@@ -138,12 +420,58 @@ func (dao *BaseDao) DeleteByWrapper(
 	return deleteByWrapper(ctx, dao, w)
 }
 
+// RestoreById 恢复逻辑删除的记录
+func (dao *BaseDao) RestoreById(
+	ctx context.Context,
+	idKey string,
+	id interface{},
+) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "RestoreById", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	w := GetWrapper()
+	w.queryInfo.where = []whereItem{createWhereItem(idKey, "=", id)}
+	return dao.RestoreByWrapper(ctx, w)
+}
+
+// RestoreByWrapper 恢复满足条件的逻辑删除的记录
+func (dao *BaseDao) RestoreByWrapper(
+	ctx context.Context,
+	w *Wrapper,
+) (affectedRow int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "RestoreByWrapper", dao.GetDbName())
+	defer func() { endSpan(span, err) }()
+
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+	if dao.logicDelete == nil {
+		err = fmt.Errorf("logic delete of %s is not set", dao.GetTableName())
+		return
+	}
+
+	err = w.GetError()
+	if err != nil {
+		return
+	}
+
+	w, err = restoreByWrapper(w, dao.logicDelete)
+	if err != nil {
+		return
+	}
+	return updateByWrapper(ctx, dao, w)
+}
+
 // SelectByWrapper 执行多条数据的查询请求
 func (dao *BaseDao) SelectByWrapper(
 	ctx context.Context,
 	dest interface{},
 	w *Wrapper,
 ) (err error) {
+	ctx, span := startDaoSpan(ctx, dao, "SelectByWrapper", dao.GetSlaveDbName())
+	defer func() { endSpan(span, err) }()
+
 	err = dao.CheckDao()
 	if err != nil {
 		return
@@ -156,11 +484,80 @@ func (dao *BaseDao) SelectByWrapper(
 	return selectByWrapper(ctx, dest, dao, w)
 }
 
+// SelectPage 分页查询，查询结果写入dest，返回的Page中包含总条数与分页信息
+// 页码与每页条数由 w.Page 与 w.Limit 指定，可以通过 w.SearchCount 与 w.CachedTotal 跳过count查询
+func (dao *BaseDao) SelectPage(
+	ctx context.Context,
+	dest interface{},
+	w *Wrapper,
+) (page Page, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "SelectPage", dao.GetSlaveDbName())
+	defer func() { endSpan(span, err) }()
+
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	err = w.GetError()
+	if err != nil {
+		return
+	}
+	return selectPageByWrapper(ctx, dest, dao, w)
+}
+
+// SelectByKeyset 游标分页查询，查询条件需要通过 w.After 或 w.AfterCursor 设置
+// 结果写入dest（结构体切片或map切片的指针），返回下一页的游标，没有更多数据时返回空字符串
+func (dao *BaseDao) SelectByKeyset(
+	ctx context.Context,
+	dest interface{},
+	w *Wrapper,
+) (nextCursor string, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "SelectByKeyset", dao.GetSlaveDbName())
+	defer func() { endSpan(span, err) }()
+
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	err = w.GetError()
+	if err != nil {
+		return
+	}
+	return selectByKeyset(ctx, dest, dao, w)
+}
+
+// IterateByWrapper 流式读取查询结果，每读取一行调用一次fn，可在fn中使用 rows.StructScan 或 rows.MapScan 读取数据
+// fn返回错误或ctx被取消时停止读取并返回该错误，没有设置Limit时读取全部数据
+func (dao *BaseDao) IterateByWrapper(
+	ctx context.Context,
+	w *Wrapper,
+	fn func(rows *sqlx.Rows) error,
+) (err error) {
+	ctx, span := startDaoSpan(ctx, dao, "IterateByWrapper", dao.GetSlaveDbName())
+	defer func() { endSpan(span, err) }()
+
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	err = w.GetError()
+	if err != nil {
+		return
+	}
+	return iterateByWrapper(ctx, dao, w, fn)
+}
+
 // SelectMapByWrapper 执行多条数据的查询请求，生成[]map[string]interface{}
 func (dao *BaseDao) SelectMapByWrapper(
 	ctx context.Context,
 	w *Wrapper,
 ) (result []map[string]interface{}, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "SelectMapByWrapper", dao.GetSlaveDbName())
+	defer func() { endSpan(span, err) }()
+
 	err = dao.CheckDao()
 	if err != nil {
 		return
@@ -180,6 +577,9 @@ func (dao *BaseDao) GetById(
 	idKey string,
 	id interface{},
 ) (err error) {
+	ctx, span := startDaoSpan(ctx, dao, "GetById", dao.GetSlaveDbName())
+	defer func() { endSpan(span, err) }()
+
 	err = dao.CheckDao()
 	if err != nil {
 		return
@@ -193,6 +593,9 @@ func (dao *BaseDao) CountByWrapper(
 	ctx context.Context,
 	w *Wrapper,
 ) (result int64, err error) {
+	ctx, span := startDaoSpan(ctx, dao, "CountByWrapper", dao.GetSlaveDbName())
+	defer func() { endSpan(span, err) }()
+
 	err = dao.CheckDao()
 	if err != nil {
 		return
@@ -0,0 +1,445 @@
+package sqlbp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// MySQL单条SQL最多支持65535个占位符
+	maxPlaceholders = 65535
+
+	defaultBatchChunkSize  = 1000
+	defaultBatchPacketSize = 4 << 20 // 与MySQL 5.7的 max_allowed_packet 默认值保持一致
+)
+
+// BatchOptions 批量操作的选项，为nil时使用默认值
+type BatchOptions struct {
+	// 每条SQL最多包含的行数，默认1000，同时会受到占位符数量的限制
+	ChunkSize int
+
+	// 每条SQL的最大字节数（按参数估算），默认4MB，应小于数据库的 max_allowed_packet
+	MaxPacketSize int
+
+	// 为true且ctx中没有事务时，开启一个事务执行所有批次，任一批次失败则全部回滚
+	// ctx中已有事务时，所有批次总是在该事务中执行
+	Transaction bool
+}
+
+// BatchResult 批量操作的结果
+type BatchResult struct {
+	// 影响的总行数
+	RowsAffected int64
+
+	// 每一批插入的第一条记录的自增ID（MySQL的LastInsertId返回的是批量插入的第一条记录的ID）
+	FirstIds []int64
+}
+
+// insertMode 插入语句的类型
+type insertMode struct {
+	verb        string     // insert into / insert ignore into / replace into
+	onDuplicate []dataItem // on duplicate key update 的更新部分，仅在verb为insert into时有效
+}
+
+var (
+	modeInsert       = insertMode{verb: "insert into"}
+	modeInsertIgnore = insertMode{verb: "insert ignore into"}
+	modeReplace      = insertMode{verb: "replace into"}
+)
+
+// newUpsertMode 生成 on duplicate key update 的插入类型
+// update为nil时，更新updateColumns中的字段为插入的值，updateColumns也为空时更新除excludes之外所有插入的字段
+// 注意：不能默认更新主键，否则其它唯一键冲突时，会将已有记录的主键改为插入的值（example: 自增主键为0）
+func newUpsertMode(
+	columns []string,
+	excludes []string,
+	updateColumns []string,
+	update *Wrapper,
+) (mode insertMode, err error) {
+	mode = modeInsert
+	if update != nil {
+		err = update.GetError()
+		if err != nil {
+			return
+		}
+		mode.onDuplicate = update.dataItems
+	} else {
+		if len(updateColumns) == 0 {
+			for _, column := range columns {
+				if !slices.Contains(excludes, column) {
+					updateColumns = append(updateColumns, column)
+				}
+			}
+		}
+		for _, column := range updateColumns {
+			mode.onDuplicate = append(mode.onDuplicate, dataItem{field: column, op: "values"})
+		}
+	}
+
+	if len(mode.onDuplicate) == 0 {
+		err = fmt.Errorf("on duplicate key update data is not allow empty")
+	}
+	return
+}
+
+// getDataIdKey 获取数据的主键字段，结构体通过实体的元信息获取，其它类型（example: map）使用 id
+func getDataIdKey(data interface{}) string {
+	if data != nil {
+		meta, err := getEntityMeta(reflect.TypeOf(data))
+		if err == nil && meta.idKey != "" {
+			return meta.idKey
+		}
+	}
+	return "id"
+}
+
+// batchRows 批量数据，每一行的字段顺序与columns一致
+type batchRows struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+// toBatchRows 将结构体或map的切片转为批量数据，所有行的字段必须一致
+// 结构体按字段定义的顺序，map按字段名排序，fill不为空时对每一行执行字段自动填充
+func toBatchRows(
+	ctx context.Context,
+	dao *BaseDao,
+	list interface{},
+	ignoreKey string,
+	fill string,
+) (result batchRows, err error) {
+	items, err := interfaceToSlice(list)
+	if err != nil {
+		return
+	}
+	if len(items) == 0 {
+		err = fmt.Errorf("batch data is not allow empty")
+		return
+	}
+
+	for i, item := range items {
+		var dataItems []dataItem
+		dataItems, err = structToDataItems(item, "db", ignoreKey)
+		if err != nil {
+			return
+		}
+		if fill != "" {
+			dataItems, err = fillDataItems(ctx, dao, fill, item, dataItems)
+			if err != nil {
+				return
+			}
+		}
+		if len(dataItems) == 0 {
+			err = fmt.Errorf("batch data of row %d is empty", i)
+			return
+		}
+
+		values := make(map[string]interface{}, len(dataItems))
+		for _, dataItem := range dataItems {
+			values[dataItem.field] = dataItem.value
+		}
+
+		if i == 0 {
+			for _, dataItem := range dataItems {
+				result.columns = append(result.columns, dataItem.field)
+			}
+			if reflect.Indirect(reflect.ValueOf(item)).Kind() == reflect.Map {
+				sort.Strings(result.columns)
+			}
+		} else if len(values) != len(result.columns) {
+			err = fmt.Errorf("batch data columns of row %d is not match row 0", i)
+			return
+		}
+
+		row := make([]interface{}, len(result.columns))
+		for j, column := range result.columns {
+			value, ok := values[column]
+			if !ok {
+				err = fmt.Errorf("batch data column %s is not exist in row %d", column, i)
+				return
+			}
+			row[j] = value
+		}
+		result.rows = append(result.rows, row)
+	}
+	return
+}
+
+// pick 按columns的顺序挑选出部分字段，columns中的字段必须存在
+func (b batchRows) pick(columns []string) (result batchRows, err error) {
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = -1
+		for j, c := range b.columns {
+			if c == column {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] == -1 {
+			err = fmt.Errorf("batch data column %s is not exist", column)
+			return
+		}
+	}
+
+	result.columns = columns
+	result.rows = make([][]interface{}, len(b.rows))
+	for i, row := range b.rows {
+		result.rows[i] = make([]interface{}, len(indexes))
+		for j, index := range indexes {
+			result.rows[i][j] = row[index]
+		}
+	}
+	return
+}
+
+// split 按行数、占位符数量与估算的字节数将数据分批，返回每一批的行数据
+// rowPlaceholders 为每一行数据在SQL中占用的占位符数量
+func (b batchRows) split(opts *BatchOptions, rowPlaceholders int) [][][]interface{} {
+	chunkSize, packetSize := defaultBatchChunkSize, defaultBatchPacketSize
+	if opts != nil && opts.ChunkSize > 0 {
+		chunkSize = opts.ChunkSize
+	}
+	if opts != nil && opts.MaxPacketSize > 0 {
+		packetSize = opts.MaxPacketSize
+	}
+	if maxRows := maxPlaceholders / rowPlaceholders; chunkSize > maxRows {
+		chunkSize = maxRows
+	}
+
+	// SQL头部的大小：字段名与表名
+	headSize := 64
+	for _, column := range b.columns {
+		headSize += len(column) + 4
+	}
+
+	chunks := make([][][]interface{}, 0)
+	start, size := 0, headSize
+	for i, row := range b.rows {
+		rowSize := estimateRowSize(row)
+		if i > start && (i-start >= chunkSize || size+rowSize > packetSize) {
+			chunks = append(chunks, b.rows[start:i])
+			start, size = i, headSize
+		}
+		size += rowSize
+	}
+	chunks = append(chunks, b.rows[start:])
+	return chunks
+}
+
+// estimateRowSize 估算一行数据在SQL中占用的字节数
+func estimateRowSize(row []interface{}) int {
+	size := 4
+	for _, value := range row {
+		switch v := value.(type) {
+		case string:
+			size += len(v) + 4
+		case []byte:
+			size += len(v) + 4
+		default:
+			size += 24
+		}
+	}
+	return size
+}
+
+// insertBatch 分批执行批量插入
+// 注意：分批执行的多条SQL并不是原子的，如需保证原子性，请在ctx中设置事务
+func insertBatch(
+	ctx context.Context,
+	dao *BaseDao,
+	mode insertMode,
+	data batchRows,
+	opts *BatchOptions,
+) (result BatchResult, err error) {
+	connect, err := getConnectByWrapper(ctx, dao, nil, true)
+	if err != nil {
+		return
+	}
+
+	data, err = withTenantRows(ctx, dao, data)
+	if err != nil {
+		return
+	}
+	mode.onDuplicate, err = withoutTenantData(ctx, dao, mode.onDuplicate)
+	if err != nil {
+		return
+	}
+
+	for _, rows := range data.split(opts, len(data.columns)) {
+		params := make([]interface{}, 0, len(rows)*len(data.columns))
+		sql := getBatchInsertSql(dao, mode, data.columns, rows, &params)
+
+		ret, err := connect.ExecContext(ctx, sql, params...)
+		if err != nil {
+			return result, err
+		}
+
+		firstId, err := ret.LastInsertId()
+		if err != nil {
+			return result, err
+		}
+		affectedRow, err := ret.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+		result.FirstIds = append(result.FirstIds, firstId)
+		result.RowsAffected += affectedRow
+	}
+	return
+}
+
+// updateBatchById 按主键分批执行批量更新，每一行的第一列为主键
+func updateBatchById(
+	ctx context.Context,
+	dao *BaseDao,
+	data batchRows,
+	opts *BatchOptions,
+) (affectedRow int64, err error) {
+	if opts != nil && opts.Transaction && GetCtxTransactionByDb(ctx, dao.GetDbName()) == nil {
+		var node *ctxTx
+		ctx, node, err = beginCtxTransaction(ctx, dao.GetDbName(), nil)
+		if err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				_ = node.finish(false)
+				return
+			}
+			err = node.finish(true)
+		}()
+	}
+
+	connect, err := getConnectByWrapper(ctx, dao, nil, true)
+	if err != nil {
+		return
+	}
+
+	query, err := prepareQueryInfo(ctx, dao, queryInfo{})
+	if err != nil {
+		return
+	}
+
+	// 每一行占用的占位符：每个更新字段的 when ? then ?，以及 in 中的主键
+	rowPlaceholders := 2*(len(data.columns)-1) + 1
+	for _, rows := range data.split(opts, rowPlaceholders) {
+		params := make([]interface{}, 0, len(rows)*rowPlaceholders)
+		sql, err := getBatchUpdateSql(dao, data.columns, rows, query.where, &params)
+		if err != nil {
+			return affectedRow, err
+		}
+
+		ret, err := connect.ExecContext(ctx, sql, params...)
+		if err != nil {
+			return affectedRow, err
+		}
+		affected, err := ret.RowsAffected()
+		if err != nil {
+			return affectedRow, err
+		}
+		affectedRow += affected
+	}
+	return
+}
+
+// 生成按主键批量更新的sql，columns的第一列为主键，where为额外的查询条件，example:
+//
+//	update `t` set `a` = case `id` when ? then ? when ? then ? end where `id` in (?, ?)
+func getBatchUpdateSql(
+	dao *BaseDao,
+	columns []string,
+	rows [][]interface{},
+	where []whereItem,
+	params *[]interface{},
+) (result string, err error) {
+	idKey := keyFormat(columns[0])
+
+	sets := make([]string, 0, len(columns)-1)
+	for i := 1; i < len(columns); i++ {
+		var builder strings.Builder
+		builder.WriteString(fmt.Sprintf("`%s` = case %s", columns[i], idKey))
+		for _, row := range rows {
+			builder.WriteString(" when ? then ?")
+			*params = append(*params, row[0], row[i])
+		}
+		builder.WriteString(" end")
+		sets = append(sets, builder.String())
+	}
+
+	for _, row := range rows {
+		*params = append(*params, row[0])
+	}
+	idMark := strings.TrimSuffix(strings.Repeat("?, ", len(rows)), ", ")
+
+	wherePart, err := getWhereSql(where, params)
+	if err != nil {
+		return
+	}
+	if wherePart != "" {
+		wherePart = " and " + wherePart
+	}
+
+	result = fmt.Sprintf(
+		"update `%s` set %s where %s in (%s)%s",
+		dao.GetTableName(),
+		strings.Join(sets, ", "),
+		idKey,
+		idMark,
+		wherePart,
+	)
+	return
+}
+
+// 生成批量insert sql，example:
+//
+//	insert into `t`(`a`, `b`) values (?, ?), (?, ?)
+//	insert into `t`(`a`, `b`) values (?, ?) on duplicate key update `b` = values(`b`), `c` = c + 1
+func getBatchInsertSql(
+	dao *BaseDao,
+	mode insertMode,
+	columns []string,
+	rows [][]interface{},
+	params *[]interface{},
+) string {
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		fields[i] = fmt.Sprintf("`%s`", column)
+	}
+	rowMark := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = rowMark
+		*params = append(*params, row...)
+	}
+
+	var updatePart string
+	if len(mode.onDuplicate) != 0 {
+		updates := make([]string, 0, len(mode.onDuplicate))
+		for _, item := range mode.onDuplicate {
+			if item.op == "value" {
+				updates = append(updates, fmt.Sprintf("`%s` = ?", item.field))
+				*params = append(*params, item.value)
+			} else if item.op == "exp" {
+				updates = append(updates, fmt.Sprintf("`%s` = %s", item.field, item.value))
+			} else if item.op == "values" {
+				updates = append(updates, fmt.Sprintf("`%s` = values(`%s`)", item.field, item.field))
+			}
+		}
+		updatePart = " on duplicate key update " + strings.Join(updates, ", ")
+	}
+
+	return fmt.Sprintf(
+		"%s `%s`(%s) values %s%s",
+		mode.verb,
+		dao.GetTableName(),
+		strings.Join(fields, ", "),
+		strings.Join(values, ", "),
+		updatePart,
+	)
+}
@@ -0,0 +1,144 @@
+package sqlbp
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInsertBatch(t *testing.T) {
+	lastId := int64(100)
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		res := fakeResult{lastId: lastId, affected: int64(strings.Count(query, "(")) - 1}
+		lastId += 10
+		return res
+	}, DbMaster)
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName(TableDevStudent)
+
+	list := make([]devStudentRow, 5)
+	for i := range list {
+		list[i] = devStudentRow{Name: "batch", Age: i}
+	}
+	result, err := dao.InsertBatch(ctx, list, &BatchOptions{ChunkSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RowsAffected != 5 || !reflect.DeepEqual(result.FirstIds, []int64{100, 110, 120}) {
+		t.Errorf("insert batch result got %+v", result)
+	}
+	log := dbs[DbMaster].getLog()
+	want := "insert into `dev_student`(`id`, `name`, `age`, `class_id`) values (?, ?, ?, ?), (?, ?, ?, ?)"
+	if len(log) != 3 || log[0] != want {
+		t.Errorf("insert batch sql got %v", log)
+	}
+
+	// map的字段按名称排序，每一行的字段必须一致
+	maps := []map[string]interface{}{{"name": "a", "age": 1}, {"age": 2, "name": "b"}}
+	_, err = dao.BaseDao.InsertBatch(ctx, maps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log = dbs[DbMaster].getLog()
+	if log[3] != "insert into `dev_student`(`age`, `name`) values (?, ?), (?, ?)" {
+		t.Errorf("insert batch map sql got %s", log[3])
+	}
+	maps = append(maps, map[string]interface{}{"name": "c", "class_id": 3})
+	if _, err = dao.BaseDao.InsertBatch(ctx, maps, nil); err == nil {
+		t.Errorf("insert batch with different columns should fail")
+	}
+
+	// 按估算的字节数分批
+	data, _ := toBatchRows(ctx, &dao.BaseDao, []map[string]interface{}{
+		{"name": strings.Repeat("x", 100)},
+		{"name": strings.Repeat("x", 100)},
+		{"name": strings.Repeat("x", 100)},
+	}, "", "")
+	if chunks := data.split(&BatchOptions{MaxPacketSize: 300}, 1); len(chunks) != 2 {
+		t.Errorf("split by packet size got %d chunks", len(chunks))
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return fakeResult{affected: 2}
+	}, DbMaster)
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName(TableDevStudent)
+	data := map[string]interface{}{"id": 1, "name": "a", "age": 10}
+
+	affect, err := dao.Upsert(ctx, data, "name")
+	if err != nil || affect != 2 {
+		t.Errorf("upsert got affect=%d, err=%v", affect, err)
+	}
+	_, err = dao.Upsert(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dao.UpsertByWrapper(ctx, data, GetWrapper().SetValues("name").SetExp("age", "age + 1").Set("class_id", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dao.InsertIgnore(ctx, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dao.ReplaceBatch(ctx, []map[string]interface{}{data, data}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"insert into `dev_student`(`age`, `id`, `name`) values (?, ?, ?) on duplicate key update `name` = values(`name`)",
+		"insert into `dev_student`(`age`, `id`, `name`) values (?, ?, ?) on duplicate key update" +
+			" `age` = values(`age`), `name` = values(`name`)",
+		"insert into `dev_student`(`age`, `id`, `name`) values (?, ?, ?) on duplicate key update" +
+			" `name` = values(`name`), `age` = age + 1, `class_id` = ?",
+		"insert ignore into `dev_student`(`age`, `id`, `name`) values (?, ?, ?)",
+		"replace into `dev_student`(`age`, `id`, `name`) values (?, ?, ?), (?, ?, ?)",
+	}
+	if log := dbs[DbMaster].getLog(); !reflect.DeepEqual(log, want) {
+		t.Errorf("upsert sql\n got: %q\nwant: %q", log, want)
+	}
+	if args := dbs[DbMaster].args[2]; !reflect.DeepEqual(args, []interface{}{int64(10), int64(1), "a", int64(3)}) {
+		t.Errorf("upsert args got %v", args)
+	}
+}
+
+func TestUpdateBatchById(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return fakeResult{affected: int64(strings.Count(query, "when")) / 2}
+	}, DbMaster)
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName(TableDevStudent)
+
+	list := []devStudentRow{{Id: 1, Name: "a", Age: 10}, {Id: 2, Name: "b", Age: 20}, {Id: 3, Name: "c", Age: 30}}
+	affect, err := dao.UpdateBatchById(ctx, list, &BatchOptions{ChunkSize: 2, Transaction: true}, "name", "age")
+	if err != nil || affect != 3 {
+		t.Errorf("update batch got affect=%d, err=%v", affect, err)
+	}
+
+	log := dbs[DbMaster].getLog()
+	want := []string{
+		"begin",
+		"update `dev_student` set `name` = case `id` when ? then ? when ? then ? end," +
+			" `age` = case `id` when ? then ? when ? then ? end where `id` in (?, ?)",
+		"update `dev_student` set `name` = case `id` when ? then ? end, `age` = case `id` when ? then ? end where `id` in (?)",
+		"commit",
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("update batch sql\n got: %q\nwant: %q", log, want)
+	}
+	wantArgs := []interface{}{int64(1), "a", int64(2), "b", int64(1), int64(10), int64(2), int64(20), int64(1), int64(2)}
+	if args := dbs[DbMaster].args[1]; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("update batch args got %v", args)
+	}
+
+	if _, err = dao.BaseDao.UpdateBatchById(ctx, list, "uid", nil); err == nil {
+		t.Errorf("update batch with unknown id key should fail")
+	}
+}
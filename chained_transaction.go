@@ -0,0 +1,131 @@
+package sqlbp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+/*
+* 多个连接的链式事务（尽力而为的一阶段提交），不是分布式事务
+* 按连接的顺序开启事务，提交时按相反的顺序提交，某个连接提交失败时回滚还没有提交的连接
+* 已经提交的连接无法回滚，此时返回的 *ChainedCommitError 中会列出已经提交的连接，需要业务自行补偿
+* 建议将最容易失败的连接放在最后（最先提交）
+* 所有连接共用一组回调：OnCommit 在所有连接都提交成功之后执行，任何连接提交失败或回滚时执行 OnRollback
+ */
+
+// ChainedTx 多个连接上的事务
+type ChainedTx struct {
+	nodes []*ctxTx
+	hooks *txHooks // 所有连接共用的回调
+}
+
+// BeginChained 按顺序在多个连接上开启事务，某个连接开启失败时回滚已经开启的事务
+func BeginChained(ctx context.Context, opts *sql.TxOptions, dbNames ...string) (chained *ChainedTx, err error) {
+	chained = &ChainedTx{nodes: make([]*ctxTx, 0, len(dbNames)), hooks: &txHooks{}}
+	for _, name := range dbNames {
+		var node *ctxTx
+		_, node, err = beginCtxTransaction(ctx, name, opts)
+		if err != nil {
+			_ = chained.Rollback()
+			return nil, err
+		}
+		node.state.hooks = chained.hooks
+		chained.nodes = append(chained.nodes, node)
+	}
+	return
+}
+
+// Context 在context中设置所有连接的事务
+func (c *ChainedTx) Context(ctx context.Context) context.Context {
+	for _, node := range c.nodes {
+		parent, _ := ctx.Value(ctxKeyTransactionPoint).(*ctxTx)
+		ctx = context.WithValue(ctx, ctxKeyTransactionPoint,
+			&ctxTx{dbName: node.dbName, tx: node.tx, state: node.state, parent: parent})
+	}
+	return ctx
+}
+
+// Commit 按相反的顺序提交，失败时回滚剩余的事务，并返回 *ChainedCommitError
+// 所有连接都提交成功之后执行OnCommit注册的回调，否则执行OnRollback注册的回调
+// 有事务被标记为只能回滚时，回滚所有的事务并返回 ErrTxRollbackOnly
+func (c *ChainedTx) Commit() error {
+	if c.rollbackOnly() {
+		return errors.Join(ErrTxRollbackOnly, c.Rollback())
+	}
+
+	committed := make([]string, 0, len(c.nodes))
+	for i := len(c.nodes) - 1; i >= 0; i-- {
+		err := c.nodes[i].end(true)
+		if err == nil {
+			committed = append(committed, c.nodes[i].dbName)
+			continue
+		}
+
+		commitErr := &ChainedCommitError{Committed: committed, Failed: c.nodes[i].dbName, Err: err}
+		for j := i - 1; j >= 0; j-- {
+			if rollbackErr := c.nodes[j].end(false); rollbackErr != nil {
+				commitErr.Err = errors.Join(commitErr.Err, rollbackErr)
+			}
+			commitErr.RolledBack = append(commitErr.RolledBack, c.nodes[j].dbName)
+		}
+		c.hooks.run(false)
+		return commitErr
+	}
+	c.hooks.run(true)
+	return nil
+}
+
+// Rollback 按相反的顺序回滚所有的事务，并执行OnRollback注册的回调
+func (c *ChainedTx) Rollback() (err error) {
+	for i := len(c.nodes) - 1; i >= 0; i-- {
+		if rollbackErr := c.nodes[i].end(false); rollbackErr != nil {
+			err = errors.Join(err, rollbackErr)
+		}
+	}
+	c.hooks.run(false)
+	return
+}
+
+// rollbackOnly 是否有事务被标记为只能回滚
+func (c *ChainedTx) rollbackOnly() bool {
+	for _, node := range c.nodes {
+		if node.state.rollbackOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// ChainedTransaction 在多个连接的事务中执行fn，fn返回nil时按相反的顺序提交，返回错误或panic时全部回滚
+func ChainedTransaction(
+	ctx context.Context,
+	dbNames []string,
+	opts *sql.TxOptions,
+	fn func(txCtx context.Context) error,
+) (err error) {
+	chained, err := BeginChained(ctx, opts, dbNames...)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = chained.Rollback()
+			panic(p)
+		}
+		if err == nil && chained.rollbackOnly() {
+			err = ErrTxRollbackOnly
+		}
+		if err != nil {
+			if rollbackErr := chained.Rollback(); rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+			return
+		}
+		err = chained.Commit()
+	}()
+
+	err = fn(chained.Context(ctx))
+	return
+}
@@ -0,0 +1,73 @@
+package sqlbp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestChainedTransaction(t *testing.T) {
+	errCommit := errors.New("commit failed")
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return fakeResult{affected: 1}
+	}, "order", "stock", "log")
+	ctx := context.Background()
+	orderDao := MustNewDao[devStudentRow]("order")
+	orderDao.SetTableName("dev_order")
+	stockDao := MustNewDao[devStudentRow]("stock")
+	stockDao.SetTableName("dev_stock")
+	names := []string{"order", "stock", "log"}
+
+	events := make([]string, 0)
+
+	// stock提交失败时，log已经提交，order被回滚
+	err := ChainedTransaction(ctx, names, nil, func(txCtx context.Context) error {
+		_, _ = orderDao.DeleteById(txCtx, 1)
+		_, _ = stockDao.DeleteById(txCtx, 2)
+		OnCommit(txCtx, func() { events = append(events, "commit") })
+		OnRollback(txCtx, func() { events = append(events, "rollback") })
+		dbs["stock"].commitErr = errCommit
+		return nil
+	})
+	var commitErr *ChainedCommitError
+	if !errors.As(err, &commitErr) || !errors.Is(err, errCommit) || !commitErr.Partial() {
+		t.Fatalf("chained commit should return ChainedCommitError, got %v", err)
+	}
+	if !reflect.DeepEqual(commitErr.Committed, []string{"log"}) || commitErr.Failed != "stock" ||
+		!reflect.DeepEqual(commitErr.RolledBack, []string{"order"}) {
+		t.Errorf("chained commit error got %+v", commitErr)
+	}
+
+	// 部分提交时只执行回滚的回调
+	if !reflect.DeepEqual(events, []string{"rollback"}) {
+		t.Errorf("partial commit hooks got %v", events)
+	}
+
+	// 所有连接提交成功之后才执行提交的回调
+	dbs["stock"].commitErr = nil
+	events = events[:0]
+	err = ChainedTransaction(ctx, names, nil, func(txCtx context.Context) error {
+		OnCommit(txCtx, func() {
+			events = append(events, "commit")
+			if log := dbs["order"].getLog(); log[len(log)-1] != "commit" {
+				t.Errorf("commit hook should run after all commits, order log %q", log)
+			}
+		})
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(events, []string{"commit"}) {
+		t.Errorf("chained commit hooks got %v, %v", events, err)
+	}
+
+	want := map[string][]string{
+		"order": {"begin", "delete from dev_order where `id` = ?", "rollback", "begin", "commit"},
+		"stock": {"begin", "delete from dev_stock where `id` = ?", "commit", "begin", "commit"},
+		"log":   {"begin", "commit", "begin", "commit"},
+	}
+	for name, db := range dbs {
+		if log := db.getLog(); !reflect.DeepEqual(log, want[name]) {
+			t.Errorf("%s sql\n got: %q\nwant: %q", name, log, want[name])
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package sqlbp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Dao 泛型版本的BaseDao，查询结果与写入数据都是强类型的
+// 表名与主键由实体T解析得到，详情请参考getEntityMeta
+//
+//	var GDevStudentDao = sqlbp.MustNewDao[DevStudentEntity](DbMaster)
+//	student, err := GDevStudentDao.GetById(ctx, 1)
+type Dao[T any] struct {
+	BaseDao
+	idKey string // 主键字段名
+}
+
+// NewDao 创建泛型Dao，T必须是结构体，否则返回错误
+func NewDao[T any](dbName string) (*Dao[T], error) {
+	meta, err := getEntityMeta(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	dao := &Dao[T]{idKey: meta.idKey}
+	dao.SetTableName(meta.tableName)
+	dao.SetDbName(dbName)
+	dao.setLogicDeleteByMeta(meta)
+	dao.setFillColumnsByMeta(meta)
+	return dao, nil
+}
+
+// MustNewDao 同NewDao，出错时panic，用于初始化包级别的Dao变量
+func MustNewDao[T any](dbName string) *Dao[T] {
+	dao, err := NewDao[T](dbName)
+	if err != nil {
+		panic(err)
+	}
+	return dao
+}
+
+func (dao *Dao[T]) SetIdKey(idKey string) {
+	dao.idKey = idKey
+}
+
+func (dao *Dao[T]) GetIdKey() string {
+	return dao.idKey
+}
+
+func (dao *Dao[T]) CheckDao() error {
+	err := dao.BaseDao.CheckDao()
+	if err != nil {
+		return err
+	}
+	if dao.idKey == "" {
+		return fmt.Errorf("id key of %s is empty", dao.GetTableName())
+	}
+	return nil
+}
+
+// GetById 通过主键查询单条记录，记录不存在时返回 ErrNotFound
+func (dao *Dao[T]) GetById(ctx context.Context, id interface{}) (*T, error) {
+	err := dao.CheckDao()
+	if err != nil {
+		return nil, err
+	}
+
+	var data T
+	err = dao.BaseDao.GetById(ctx, &data, dao.idKey, id)
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// SelectOne 查询满足条件的第一条记录，记录不存在时返回 ErrNotFound
+func (dao *Dao[T]) SelectOne(ctx context.Context, w *Wrapper) (*T, error) {
+	if w == nil {
+		w = GetWrapper()
+	}
+	query := *w
+	query.queryInfo.limit = 1
+	query.queryInfo.page = 0
+
+	list, err := dao.SelectList(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return &list[0], nil
+}
+
+// SelectList 查询多条记录，w为nil时查询全部（受默认limit限制）
+func (dao *Dao[T]) SelectList(ctx context.Context, w *Wrapper) ([]T, error) {
+	if w == nil {
+		w = GetWrapper()
+	}
+
+	list := make([]T, 0)
+	err := dao.BaseDao.SelectByWrapper(ctx, &list, w)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Count 查询满足条件的记录条数
+func (dao *Dao[T]) Count(ctx context.Context, w *Wrapper) (int64, error) {
+	if w == nil {
+		w = GetWrapper()
+	}
+	return dao.BaseDao.CountByWrapper(ctx, w)
+}
+
+// SelectPage 分页查询，返回当前页的记录与分页信息
+func (dao *Dao[T]) SelectPage(ctx context.Context, w *Wrapper) (TypedPage[T], error) {
+	if w == nil {
+		w = GetWrapper()
+	}
+
+	list := make([]T, 0)
+	page, err := dao.BaseDao.SelectPage(ctx, &list, w)
+	if err != nil {
+		return TypedPage[T]{}, err
+	}
+	return TypedPage[T]{
+		Records: list,
+		Total:   page.Total,
+		Pages:   page.Pages,
+		Current: page.Current,
+		Size:    page.Size,
+	}, nil
+}
+
+// SelectByKeyset 游标分页查询，返回当前页的记录与下一页的游标，没有更多数据时游标为空
+func (dao *Dao[T]) SelectByKeyset(ctx context.Context, w *Wrapper) (list []T, nextCursor string, err error) {
+	list = make([]T, 0)
+	nextCursor, err = dao.BaseDao.SelectByKeyset(ctx, &list, w)
+	if err != nil {
+		return nil, "", err
+	}
+	return
+}
+
+// Rows 执行查询并返回强类型的结果集游标，详情请参考QueryRows
+func (dao *Dao[T]) Rows(ctx context.Context, w *Wrapper) (*Rows[T], error) {
+	return QueryRows[T](ctx, &dao.BaseDao, w)
+}
+
+// Iterate 流式读取查询结果，每读取一行调用一次fn，fn返回错误或ctx被取消时停止读取并返回该错误
+func (dao *Dao[T]) Iterate(ctx context.Context, w *Wrapper, fn func(data *T) error) error {
+	rows, err := dao.Rows(ctx, w)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		data, err := rows.Scan()
+		if err != nil {
+			return err
+		}
+		err = fn(data)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Insert 插入数据，主键为整数且值为0时，会将自增ID回写到data中
+func (dao *Dao[T]) Insert(ctx context.Context, data *T) (lastId int64, err error) {
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	lastId, err = dao.BaseDao.Insert(ctx, data)
+	if err != nil {
+		return
+	}
+
+	id := dao.idValue(data)
+	if id.IsValid() && id.CanSet() && id.IsZero() {
+		switch id.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			id.SetInt(lastId)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			id.SetUint(uint64(lastId))
+		}
+	}
+	return
+}
+
+// InsertBatch 批量插入数据，详情请参考BaseDao.InsertBatch
+func (dao *Dao[T]) InsertBatch(ctx context.Context, list []T, opts *BatchOptions) (BatchResult, error) {
+	return dao.BaseDao.InsertBatch(ctx, list, opts)
+}
+
+// UpdateById 通过data中的主键更新整条记录
+func (dao *Dao[T]) UpdateById(ctx context.Context, data *T) (affectedRow int64, err error) {
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+
+	id := dao.idValue(data)
+	if !id.IsValid() {
+		err = fmt.Errorf("id key %s is not exist in %T", dao.idKey, data)
+		return
+	}
+	return dao.BaseDao.UpdateById(ctx, data, dao.idKey, id.Interface())
+}
+
+// UpdateBatchById 按主键批量更新，详情请参考BaseDao.UpdateBatchById
+func (dao *Dao[T]) UpdateBatchById(ctx context.Context, list []T, opts *BatchOptions, columns ...string) (int64, error) {
+	err := dao.CheckDao()
+	if err != nil {
+		return 0, err
+	}
+	return dao.BaseDao.UpdateBatchById(ctx, list, dao.idKey, opts, columns...)
+}
+
+// DeleteById 通过主键删除记录
+func (dao *Dao[T]) DeleteById(ctx context.Context, id interface{}) (affectedRow int64, err error) {
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+	return dao.BaseDao.DeleteById(ctx, dao.idKey, id)
+}
+
+// RestoreById 通过主键恢复逻辑删除的记录
+func (dao *Dao[T]) RestoreById(ctx context.Context, id interface{}) (affectedRow int64, err error) {
+	err = dao.CheckDao()
+	if err != nil {
+		return
+	}
+	return dao.BaseDao.RestoreById(ctx, dao.idKey, id)
+}
+
+// idValue 获取data中主键字段的值，不存在时返回无效的reflect.Value
+func (dao *Dao[T]) idValue(data *T) reflect.Value {
+	v := reflect.ValueOf(data).Elem()
+	meta, err := getEntityMeta(v.Type())
+	if err != nil {
+		return reflect.Value{}
+	}
+	field := meta.getField(dao.idKey)
+	if field == nil {
+		return reflect.Value{}
+	}
+	return v.FieldByIndex(field.index)
+}
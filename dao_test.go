@@ -0,0 +1,64 @@
+package sqlbp
+
+import (
+	"reflect"
+	"testing"
+)
+
+type devScoreEntity struct {
+	ScoreId int64  `db:"score_id" sqlbp:"pk"`
+	Subject string `db:"subject"`
+	remark  string `db:"remark"`
+}
+
+type devCourse struct {
+	Id   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func (devCourse) TableName() string {
+	return "dev_course_v2"
+}
+
+func TestNewDao(t *testing.T) {
+	studentDao, err := NewDao[DevStudentEntity](DbMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoreDao := MustNewDao[devScoreEntity](DbMaster)
+	courseDao := MustNewDao[devCourse](DbMaster)
+
+	cases := []struct {
+		table string
+		idKey string
+		want  [2]string
+	}{
+		{studentDao.GetTableName(), studentDao.GetIdKey(), [2]string{TableDevStudent, "id"}},
+		{scoreDao.GetTableName(), scoreDao.GetIdKey(), [2]string{"dev_score", "score_id"}},
+		{courseDao.GetTableName(), courseDao.GetIdKey(), [2]string{"dev_course_v2", "id"}},
+	}
+	for _, c := range cases {
+		if c.table != c.want[0] || c.idKey != c.want[1] {
+			t.Errorf("got table=%s id=%s, want %v", c.table, c.idKey, c.want)
+		}
+	}
+
+	// 不是结构体时返回错误
+	if _, err = NewDao[int](DbMaster); err == nil {
+		t.Error("new dao of int should return error")
+	}
+
+	meta, err := getEntityMeta(reflect.TypeOf(devScoreEntity{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.fields) != 2 {
+		t.Errorf("unexported field should be ignored, fields=%v", meta.fields)
+	}
+
+	for name, want := range map[string]string{"DevStudent": "dev_student", "UserID": "user_id", "HTTPServer": "http_server"} {
+		if got := toSnakeCase(name); got != want {
+			t.Errorf("toSnakeCase(%s) got %s, want %s", name, got, want)
+		}
+	}
+}
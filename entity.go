@@ -0,0 +1,129 @@
+package sqlbp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/*
+* 实体结构体的元信息，通过结构体的tag解析
+* db 标签：对应的字段名（与sqlx保持一致）
+* sqlbp 标签：框架使用的额外信息，多个选项用逗号分隔，example: `db:"id" sqlbp:"pk"`
+*   pk 主键（没有指定时使用字段名为id的字段）
+*   fill 自动填充的字段，取值 insert / update / insert_update，详情请参考fill.go
+*   version 乐观锁版本号字段，必须是整数，详情请参考BaseDao.UpdateById
+*   logic_delete 逻辑删除字段，可选 deleted=已删除的值,not_deleted=未删除的值，详情请参考logic_delete.go
+ */
+
+// tableNamer 实体可以通过实现该接口指定表名
+type tableNamer interface {
+	TableName() string
+}
+
+type entityField struct {
+	column  string            // 字段名
+	index   []int             // 在结构体中的位置
+	options map[string]string // sqlbp 标签中的选项
+}
+
+type entityMeta struct {
+	tableName string
+	idKey     string
+	fields    []entityField
+}
+
+// 缓存解析结果 reflect.Type => *entityMeta
+var entityMetaCache sync.Map
+
+// getEntityMeta 解析实体的元信息
+// 表名优先使用 TableName() 方法的返回值，其次是去掉Entity后缀的结构体名称转下划线，example: DevStudentEntity => dev_student
+func getEntityMeta(t reflect.Type) (meta *entityMeta, err error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		err = fmt.Errorf("entity must struct, not allow %s", t)
+		return
+	}
+
+	if v, ok := entityMetaCache.Load(t); ok {
+		meta = v.(*entityMeta)
+		return
+	}
+
+	meta = &entityMeta{}
+	if namer, ok := reflect.New(t).Interface().(tableNamer); ok {
+		meta.tableName = namer.TableName()
+	} else {
+		meta.tableName = toSnakeCase(strings.TrimSuffix(t.Name(), "Entity"))
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		column := f.Tag.Get("db")
+		if column == "" || column == "-" || !f.IsExported() {
+			continue
+		}
+		field := entityField{column: column, index: f.Index, options: parseTagOptions(f.Tag.Get("sqlbp"))}
+		meta.fields = append(meta.fields, field)
+
+		if _, ok := field.options["pk"]; ok {
+			meta.idKey = column
+		}
+	}
+	if meta.idKey == "" && meta.getField("id") != nil {
+		meta.idKey = "id"
+	}
+
+	entityMetaCache.Store(t, meta)
+	return
+}
+
+// getField 通过字段名查找字段
+func (meta *entityMeta) getField(column string) *entityField {
+	for i := range meta.fields {
+		if meta.fields[i].column == column {
+			return &meta.fields[i]
+		}
+	}
+	return nil
+}
+
+// parseTagOptions 解析sqlbp标签，example: "pk,fill=insert" => {"pk": "", "fill": "insert"}
+func parseTagOptions(tag string) map[string]string {
+	options := make(map[string]string)
+	for _, item := range strings.Split(tag, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pos := strings.Index(item, "=")
+		if pos == -1 {
+			options[item] = ""
+		} else {
+			options[item[:pos]] = item[pos+1:]
+		}
+	}
+	return options
+}
+
+// toSnakeCase 驼峰转下划线，example: DevStudent => dev_student
+func toSnakeCase(name string) string {
+	var builder strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// 连续的大写字母视为一个单词，example: UserID => user_id
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				builder.WriteByte('_')
+			}
+			builder.WriteRune(unicode.ToLower(r))
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
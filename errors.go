@@ -0,0 +1,161 @@
+package sqlbp
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"regexp"
+)
+
+// ErrOptimisticLock 乐观锁更新失败：记录已被其它操作修改（版本号不一致）或者记录不存在，调用方可以重新查询后重试
+var ErrOptimisticLock = errors.New("optimistic lock failed: record is modified or not exist")
+
+// ErrTenantMissing 开启了多租户隔离，但是context中没有设置当前租户
+var ErrTenantMissing = errors.New("tenant id is not set in context")
+
+/*
+* 数据库错误的分类，执行SQL的错误统一在拦截器中转换，并包装为 *StatementError
+* 开启、提交事务与读取结果集的错误没有对应的SQL，同样经过转换，但是不包装为 *StatementError
+* 可以使用 errors.Is 判断分类，使用 errors.As 获取 *StatementError、*DuplicateKeyError 或者驱动的 *mysql.MySQLError
+* 注意：返回的错误都经过包装，不能再使用 err == sql.ErrNoRows 或 err.(*mysql.MySQLError) 判断
+ */
+var (
+	// ErrNotFound 记录不存在，兼容 errors.Is(err, sql.ErrNoRows)
+	ErrNotFound = fmt.Errorf("record not found: %w", sql.ErrNoRows)
+
+	// ErrDuplicateKey 唯一键冲突，可以通过 errors.As 获取 *DuplicateKeyError 中的键名
+	ErrDuplicateKey = errors.New("duplicate key")
+
+	// ErrDeadlock 死锁，事务已被回滚，可以重试整个事务
+	ErrDeadlock = errors.New("deadlock found when trying to get lock")
+
+	// ErrLockWaitTimeout 等待行锁超时
+	ErrLockWaitTimeout = errors.New("lock wait timeout exceeded")
+
+	// ErrForeignKey 违反外键约束
+	ErrForeignKey = errors.New("foreign key constraint fails")
+)
+
+// MySQL的错误码
+const (
+	mysqlErrDuplicateKey    = 1062
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+	mysqlErrRowIsReferenced = 1451
+	mysqlErrNoReferencedRow = 1452
+)
+
+// StatementError 执行SQL的错误，包含表名与SQL
+type StatementError struct {
+	Err   error  // 转换之后的错误，example: ErrDuplicateKey
+	Cause error  // 驱动返回的原始错误
+	Table string // 表名
+	Sql   string // SQL语句
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("%s, table: %s, sql: %s", e.Err.Error(), e.Table, e.Sql)
+}
+
+func (e *StatementError) Unwrap() []error {
+	if e.Err == e.Cause {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Cause}
+}
+
+// DuplicateKeyError 唯一键冲突的详细信息
+type DuplicateKeyError struct {
+	Key   string // 冲突的键名，example: uk_name
+	Entry string // 冲突的值
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate entry '%s' for key '%s'", e.Entry, e.Key)
+}
+
+func (e *DuplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+// MySQL 8.0 中键名带有表名，example: Duplicate entry 'a' for key 'dev_user.uk_name'
+var duplicateKeyRegexp = regexp.MustCompile(`Duplicate entry '(.*)' for key '(?:[^']*\.)?([^'.]*)'`)
+
+// translateError 将驱动返回的错误转换为对应的分类，并包装表名与SQL
+func translateError(stmt *Statement, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StatementError{Err: classifyError(err), Cause: err, Table: stmt.Table, Sql: stmt.Sql}
+}
+
+// translateDriverError 转换没有对应SQL的驱动错误（事务、结果集），不能分类的错误原样返回
+func translateDriverError(err error) error {
+	if err == nil {
+		return nil
+	}
+	translated := classifyError(err)
+	if translated == err {
+		return err
+	}
+	return fmt.Errorf("%w: %w", translated, err)
+}
+
+// classifyError 获取驱动返回的错误对应的分类，不能分类时返回err
+func classifyError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlErrDuplicateKey:
+			dup := &DuplicateKeyError{}
+			if match := duplicateKeyRegexp.FindStringSubmatch(mysqlErr.Message); match != nil {
+				dup.Entry, dup.Key = match[1], match[2]
+			}
+			return dup
+		case mysqlErrDeadlock:
+			return ErrDeadlock
+		case mysqlErrLockWaitTimeout:
+			return ErrLockWaitTimeout
+		case mysqlErrRowIsReferenced, mysqlErrNoReferencedRow:
+			return ErrForeignKey
+		}
+	}
+	return err
+}
+
+// ErrTxRollbackOnly 加入的事务中有操作执行失败，事务已被回滚
+var ErrTxRollbackOnly = errors.New("transaction has been marked as rollback-only")
+
+// ErrTxExists 传播方式为 PropagationNever，但是context中已有事务
+var ErrTxExists = errors.New("existing transaction found for propagation never")
+
+// ErrTxMismatch context中只有其它连接的事务，并且设置了 TxMismatchError
+var ErrTxMismatch = errors.New("transaction in context belongs to another db")
+
+// ChainedCommitError 链式事务提交失败，Committed不为空时为部分提交，已经提交的连接无法回滚
+type ChainedCommitError struct {
+	Committed  []string // 已经提交的连接
+	Failed     string   // 提交失败的连接
+	RolledBack []string // 已经回滚的连接
+	Err        error    // 提交失败的错误
+}
+
+func (e *ChainedCommitError) Error() string {
+	if e.Partial() {
+		return fmt.Sprintf("chained transaction partially committed, committed: %v, failed: %s, rolled back: %v, err: %v",
+			e.Committed, e.Failed, e.RolledBack, e.Err)
+	}
+	return fmt.Sprintf("chained transaction commit failed: %s, rolled back: %v, err: %v", e.Failed, e.RolledBack, e.Err)
+}
+
+func (e *ChainedCommitError) Unwrap() error {
+	return e.Err
+}
+
+// Partial 是否有连接已经提交
+func (e *ChainedCommitError) Partial() bool {
+	return len(e.Committed) > 0
+}
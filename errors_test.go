@@ -0,0 +1,57 @@
+package sqlbp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"testing"
+)
+
+func TestTranslateError(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		if isSelect(query) {
+			return fakeResult{columns: studentRows(0).columns}
+		}
+		if len(args) > 1 && args[1] == "dup" {
+			return fakeResult{err: &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'dup' for key 'dev_student.uk_name'"}}
+		}
+		return fakeResult{err: &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}}
+	}, DbMaster)
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName("dev_student")
+
+	_, err := dao.GetById(ctx, 1)
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("get by id should return ErrNotFound, got %v", err)
+	}
+
+	_, err = dao.Insert(ctx, &devStudentRow{Name: "dup"})
+	var dup *DuplicateKeyError
+	var mysqlErr *mysql.MySQLError
+	var stmtErr *StatementError
+	if !errors.Is(err, ErrDuplicateKey) || !errors.As(err, &dup) || dup.Key != "uk_name" || dup.Entry != "dup" {
+		t.Errorf("insert should return DuplicateKeyError, got %v", err)
+	}
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		t.Errorf("driver error should be kept, got %v", err)
+	}
+	if !errors.As(err, &stmtErr) || stmtErr.Table != "dev_student" || stmtErr.Sql == "" {
+		t.Errorf("statement error got %v", err)
+	}
+
+	_, err = dao.UpdateByWrapper(ctx, GetWrapper().Set("name", "a").Eq("id", 1))
+	if !errors.Is(err, ErrLockWaitTimeout) || errors.Is(err, ErrDeadlock) {
+		t.Errorf("update should return ErrLockWaitTimeout, got %v", err)
+	}
+
+	// 提交事务的错误同样经过转换
+	dbs[DbMaster].commitErr = &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	err = Transaction(ctx, DbMaster, func(txCtx context.Context) error {
+		return nil
+	})
+	if !errors.Is(err, ErrDeadlock) || !errors.As(err, &mysqlErr) || mysqlErr.Number != 1213 {
+		t.Errorf("commit should return ErrDeadlock, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package sqlbp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 用于单元测试的假数据库驱动，记录执行过的SQL，并返回handler指定的结果，不需要连接真实的数据库
+
+type fakeResult struct {
+	columns  []string
+	rows     [][]driver.Value
+	lastId   int64
+	affected int64
+	err      error
+}
+
+type fakeDb struct {
+	mu      sync.Mutex
+	log     []string        // 执行过的SQL，事务操作记录为 begin/commit/rollback
+	args    [][]interface{} // 与log一一对应的参数
+	handler func(query string, args []interface{}) fakeResult
+
+	commitErr error // 提交事务时返回的错误
+}
+
+var (
+	fakeDbMap   sync.Map
+	fakeDbIndex int
+	fakeDbOnce  sync.Once
+)
+
+// newFakeDb 创建一个假的数据库连接
+func newFakeDb(handler func(query string, args []interface{}) fakeResult) (*sqlx.DB, *fakeDb) {
+	fakeDbOnce.Do(func() {
+		sql.Register("sqlbp_fake", fakeDriver{})
+	})
+	fakeDbIndex++
+	name := fmt.Sprintf("fake_%d", fakeDbIndex)
+	fdb := &fakeDb{handler: handler}
+	fakeDbMap.Store(name, fdb)
+	return sqlx.MustOpen("sqlbp_fake", name), fdb
+}
+
+// useFakeDb 将假的数据库连接注册为names对应的连接，测试结束后还原
+func useFakeDb(t *testing.T, handler func(query string, args []interface{}) fakeResult, names ...string) map[string]*fakeDb {
+	oldMap, oldInit := linkMap, isInit
+	t.Cleanup(func() {
+		linkMap, isInit = oldMap, oldInit
+	})
+
+	result := make(map[string]*fakeDb)
+	linkMap = make(map[string]*sqlx.DB)
+	for _, name := range names {
+		db, fdb := newFakeDb(handler)
+		linkMap[name] = db
+		result[name] = fdb
+	}
+	isInit = true
+	return result
+}
+
+func (db *fakeDb) record(query string, args []interface{}) fakeResult {
+	db.mu.Lock()
+	db.log = append(db.log, query)
+	db.args = append(db.args, args)
+	db.mu.Unlock()
+	if query == "commit" && db.commitErr != nil {
+		return fakeResult{err: db.commitErr}
+	}
+	if db.handler == nil || query == "begin" || query == "commit" || query == "rollback" {
+		return fakeResult{affected: 1}
+	}
+	return db.handler(query, args)
+}
+
+func (db *fakeDb) getLog() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.log...)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	v, ok := fakeDbMap.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("fake db %s is not exist", name)
+	}
+	return &fakeConn{db: v.(*fakeDb)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDb
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare is not support")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	query := "begin"
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		query += " " + sql.IsolationLevel(opts.Isolation).String()
+	}
+	if opts.ReadOnly {
+		query += " read only"
+	}
+	res := c.db.record(query, nil)
+	if res.err != nil {
+		return nil, res.err
+	}
+	return &fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res := c.db.record(query, namedValues(args))
+	if res.err != nil {
+		return nil, res.err
+	}
+	return fakeExecResult{lastId: res.lastId, affected: res.affected}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res := c.db.record(query, namedValues(args))
+	if res.err != nil {
+		return nil, res.err
+	}
+	return &fakeRows{columns: res.columns, rows: res.rows}, nil
+}
+
+func namedValues(args []driver.NamedValue) []interface{} {
+	list := make([]interface{}, len(args))
+	for i, arg := range args {
+		list[i] = arg.Value
+	}
+	return list
+}
+
+type fakeTx struct {
+	db *fakeDb
+}
+
+func (tx *fakeTx) Commit() error {
+	return tx.db.record("commit", nil).err
+}
+
+func (tx *fakeTx) Rollback() error {
+	return tx.db.record("rollback", nil).err
+}
+
+type fakeExecResult struct {
+	lastId   int64
+	affected int64
+}
+
+func (r fakeExecResult) LastInsertId() (int64, error) {
+	return r.lastId, nil
+}
+
+func (r fakeExecResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+// studentRows 生成n行dev_student的查询结果
+func studentRows(n int) fakeResult {
+	res := fakeResult{columns: []string{"id", "name", "age", "class_id"}}
+	for i := 1; i <= n; i++ {
+		res.rows = append(res.rows, []driver.Value{int64(i), fmt.Sprintf("name_%d", i), int64(10 + i), int64(1)})
+	}
+	return res
+}
+
+// isSelect 判断是否为查询语句
+func isSelect(query string) bool {
+	return strings.HasPrefix(query, "select")
+}
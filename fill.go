@@ -0,0 +1,232 @@
+package sqlbp
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+/*
+* 字段自动填充，参考Mybatis Plus的MetaObjectHandler
+* 在 Insert、InsertBatch、Upsert、UpdateById、UpdateByWrapper 时，由处理器为可填充的字段赋值
+* 可填充的字段有两种来源：
+*   1. 实体标签：`db:"create_time" sqlbp:"fill=insert"`，取值 insert / update / insert_update
+*   2. Dao的设置：dao.SetFillColumns(FillInsert, "create_time")，map与Wrapper.Set的数据只能使用这种方式
+* 只有没有赋值的字段才会被填充：结构体字段为零值，map与Wrapper中不存在或为nil
+* UpdateById 与 Upsert 默认的更新字段中不包括只在插入时填充的字段，避免创建时间等字段被覆盖
+ */
+
+const (
+	FillInsert       = "insert"
+	FillUpdate       = "update"
+	FillInsertUpdate = "insert_update"
+)
+
+// MetaObjectHandler 字段自动填充处理器
+type MetaObjectHandler interface {
+	InsertFill(ctx context.Context, meta *MetaObject)
+	UpdateFill(ctx context.Context, meta *MetaObject)
+}
+
+var globalMetaObjectHandler MetaObjectHandler
+
+// SetMetaObjectHandler 设置全局的字段自动填充处理器，Dao中设置的处理器优先
+func SetMetaObjectHandler(handler MetaObjectHandler) {
+	globalMetaObjectHandler = handler
+}
+
+// SetMetaObjectHandler 设置当前Dao的字段自动填充处理器
+func (dao *BaseDao) SetMetaObjectHandler(handler MetaObjectHandler) {
+	dao.metaObjectHandler = handler
+}
+
+// SetFillColumns 设置可填充的字段，fill 取值 FillInsert / FillUpdate / FillInsertUpdate
+func (dao *BaseDao) SetFillColumns(fill string, columns ...string) {
+	if dao.fillColumns == nil {
+		dao.fillColumns = make(map[string][]string)
+	}
+	dao.fillColumns[fill] = append(dao.fillColumns[fill], columns...)
+}
+
+// setFillColumnsByMeta 根据实体标签设置可填充的字段，使Wrapper与map数据也能按实体标签填充
+func (dao *BaseDao) setFillColumnsByMeta(meta *entityMeta) {
+	for _, field := range meta.fields {
+		if fill, ok := field.options["fill"]; ok {
+			dao.SetFillColumns(fill, field.column)
+		}
+	}
+}
+
+// MetaObject 待写入的数据，处理器通过它为可填充的字段赋值
+type MetaObject struct {
+	tableName string
+	columns   map[string]bool
+	dataItems []dataItem
+}
+
+// TableName 当前操作的表名
+func (m *MetaObject) TableName() string {
+	return m.tableName
+}
+
+// CanFill 字段是否可填充
+func (m *MetaObject) CanFill(column string) bool {
+	return m.columns[column]
+}
+
+// GetValue 获取字段的值，不存在时返回nil
+func (m *MetaObject) GetValue(column string) interface{} {
+	for _, item := range m.dataItems {
+		if item.field == column && item.op == "value" {
+			return item.value
+		}
+	}
+	return nil
+}
+
+// FillValue 为字段赋值，字段不可填充或者已经赋值时不作处理
+func (m *MetaObject) FillValue(column string, value interface{}) *MetaObject {
+	if !m.columns[column] {
+		return m
+	}
+
+	for i, item := range m.dataItems {
+		if item.field != column {
+			continue
+		}
+		if item.op == "value" && isZeroValue(item.value) {
+			m.dataItems[i].value = value
+		}
+		return m
+	}
+	m.dataItems = append(m.dataItems, dataItem{field: column, op: "value", value: value})
+	return m
+}
+
+// fillDataItems 调用处理器填充数据，data为原始数据（结构体或map），用于读取实体标签，可以为nil
+func fillDataItems(
+	ctx context.Context,
+	dao *BaseDao,
+	fill string,
+	data interface{},
+	dataItems []dataItem,
+) ([]dataItem, error) {
+	handler := dao.metaObjectHandler
+	if handler == nil {
+		handler = globalMetaObjectHandler
+	}
+	if handler == nil {
+		return dataItems, nil
+	}
+
+	columns, err := getFillColumns(dao, data, fill, FillInsertUpdate)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return dataItems, nil
+	}
+
+	// 复制一份，不修改调用方的数据
+	meta := &MetaObject{
+		tableName: dao.GetTableName(),
+		columns:   columns,
+		dataItems: append(make([]dataItem, 0, len(dataItems)+len(columns)), dataItems...),
+	}
+	if fill == FillInsert {
+		handler.InsertFill(ctx, meta)
+	} else {
+		handler.UpdateFill(ctx, meta)
+	}
+	return meta.dataItems, nil
+}
+
+// getFillColumns 获取fills中任一类型的可填充字段，来源为Dao的设置与data（可以为nil）的实体标签
+func getFillColumns(dao *BaseDao, data interface{}, fills ...string) (map[string]bool, error) {
+	columns := make(map[string]bool)
+	for _, key := range fills {
+		for _, column := range dao.fillColumns[key] {
+			columns[column] = true
+		}
+	}
+	if v := reflect.Indirect(reflect.ValueOf(data)); v.Kind() == reflect.Struct {
+		meta, err := getEntityMeta(v.Type())
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range meta.fields {
+			for _, key := range fills {
+				if field.options["fill"] == key {
+					columns[field.column] = true
+				}
+			}
+		}
+	}
+	return columns, nil
+}
+
+// withoutInsertFill 去掉只在插入时填充的字段（example: create_time），避免更新整条记录时被零值覆盖
+func withoutInsertFill(dao *BaseDao, data interface{}, dataItems []dataItem) ([]dataItem, error) {
+	columns, err := getFillColumns(dao, data, FillInsert)
+	if err != nil || len(columns) == 0 {
+		return dataItems, err
+	}
+	result := make([]dataItem, 0, len(dataItems))
+	for _, item := range dataItems {
+		if !columns[item.field] {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func isZeroValue(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	return !v.IsValid() || v.IsZero()
+}
+
+// 操作人在context中的key
+type ctxKeyOperator struct{}
+
+// WithOperator 在context中设置当前操作人，供字段自动填充处理器使用
+func WithOperator(ctx context.Context, operator interface{}) context.Context {
+	return context.WithValue(ctx, ctxKeyOperator{}, operator)
+}
+
+// GetOperator 获取context中的当前操作人，没有设置时返回nil
+func GetOperator(ctx context.Context) interface{} {
+	return ctx.Value(ctxKeyOperator{})
+}
+
+// DefaultMetaObjectHandler 常用的填充处理器：创建/更新时间使用当前时间，创建/更新人使用context中的操作人
+// 字段名为空时不填充该字段
+type DefaultMetaObjectHandler struct {
+	CreateTime string // example: create_time
+	UpdateTime string // example: update_time
+	CreatedBy  string // example: created_by
+	UpdatedBy  string // example: updated_by
+}
+
+func (h DefaultMetaObjectHandler) InsertFill(ctx context.Context, meta *MetaObject) {
+	now := time.Now()
+	operator := GetOperator(ctx)
+	h.fill(meta, h.CreateTime, now)
+	h.fill(meta, h.UpdateTime, now)
+	if operator != nil {
+		h.fill(meta, h.CreatedBy, operator)
+		h.fill(meta, h.UpdatedBy, operator)
+	}
+}
+
+func (h DefaultMetaObjectHandler) UpdateFill(ctx context.Context, meta *MetaObject) {
+	h.fill(meta, h.UpdateTime, time.Now())
+	if operator := GetOperator(ctx); operator != nil {
+		h.fill(meta, h.UpdatedBy, operator)
+	}
+}
+
+func (h DefaultMetaObjectHandler) fill(meta *MetaObject, column string, value interface{}) {
+	if column != "" {
+		meta.FillValue(column, value)
+	}
+}
@@ -0,0 +1,69 @@
+package sqlbp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type devOrderEntity struct {
+	Id         int64     `db:"id"`
+	Amount     int64     `db:"amount"`
+	CreateTime time.Time `db:"create_time" sqlbp:"fill=insert"`
+	UpdateTime time.Time `db:"update_time" sqlbp:"fill=insert_update"`
+	CreatedBy  string    `db:"created_by" sqlbp:"fill=insert"`
+}
+
+func TestMetaObjectHandler(t *testing.T) {
+	dbs := useFakeDb(t, nil, DbMaster)
+	ctx := WithOperator(context.Background(), "admin")
+	dao := MustNewDao[devOrderEntity](DbMaster)
+	dao.SetMetaObjectHandler(DefaultMetaObjectHandler{
+		CreateTime: "create_time",
+		UpdateTime: "update_time",
+		CreatedBy:  "created_by",
+		UpdatedBy:  "updated_by",
+	})
+	dao.SetFillColumns(FillUpdate, "updated_by")
+
+	// 已经赋值的字段不会被填充
+	createTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	_, _ = dao.Insert(ctx, &devOrderEntity{Amount: 10, CreateTime: createTime})
+	_, _ = dao.UpdateById(ctx, &devOrderEntity{Id: 1, Amount: 20})
+	_, _ = dao.UpdateByWrapper(ctx, GetWrapper().Set("amount", 30).Eq("id", 1))
+	_, _ = dao.BaseDao.InsertBatch(ctx, []map[string]interface{}{{"amount": 1}, {"amount": 2}}, nil)
+	_, _ = dao.BaseDao.Upsert(ctx, &devOrderEntity{Amount: 5})
+
+	log := dbs[DbMaster].getLog()
+	want := []string{
+		"insert into `dev_order`(`id`, `amount`, `create_time`, `update_time`, `created_by`) values (?, ?, ?, ?, ?)",
+		// 只在插入时填充的字段不会被更新
+		"update dev_order set `amount` = ?, `update_time` = ?, `updated_by` = ? where `id` = ?",
+		"update dev_order set `amount` = ?, `update_time` = ?, `updated_by` = ? where `id` = ?",
+		"insert into `dev_order`(`amount`, `create_time`, `created_by`, `update_time`) values (?, ?, ?, ?), (?, ?, ?, ?)",
+		"insert into `dev_order`(`id`, `amount`, `create_time`, `update_time`, `created_by`) values (?, ?, ?, ?, ?)" +
+			" on duplicate key update `amount` = values(`amount`), `update_time` = values(`update_time`)",
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("fill sql\n got: %q\nwant: %q", log, want)
+	}
+
+	args := dbs[DbMaster].args[0]
+	if args[2] != createTime || isZeroValue(args[3]) || args[4] != "admin" {
+		t.Errorf("insert fill args got %v", args)
+	}
+	args = dbs[DbMaster].args[1]
+	if isZeroValue(args[1]) || args[2] != "admin" {
+		t.Errorf("update fill args got %v", args)
+	}
+	// Wrapper与map数据按实体标签填充
+	args = dbs[DbMaster].args[2]
+	if isZeroValue(args[1]) || args[2] != "admin" {
+		t.Errorf("update wrapper fill args got %v", args)
+	}
+	args = dbs[DbMaster].args[3]
+	if isZeroValue(args[1]) || args[2] != "admin" || isZeroValue(args[3]) || args[6] != "admin" {
+		t.Errorf("batch insert fill args got %v", args)
+	}
+}
@@ -0,0 +1,239 @@
+package sqlbp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+* 拦截器，在每一条SQL执行前后调用，可以用于日志、监控、审计等功能
+* Before 按注册顺序调用（先全局后Dao），可以修改SQL与参数，返回错误时不再执行SQL，并将错误返回给调用方
+* Before 中设置 stmt.Skip 时跳过执行，Exec返回 stmt.RowsAffected，Select不修改dest，Get返回ErrNotFound
+* 执行SQL的错误会转换为 *StatementError，After中可以通过 stmt.Err 获取
+* After 按注册的相反顺序调用，只会调用Before已经执行过的拦截器（SQL日志除外，被拒绝的SQL同样会记录日志）
+ */
+
+const (
+	StatementSelect = "select"
+	StatementInsert = "insert"
+	StatementUpdate = "update"
+	StatementDelete = "delete"
+)
+
+// Statement 一次SQL执行的信息
+type Statement struct {
+	Kind         string        // SQL类型：select / insert / update / delete
+	Dao          *BaseDao      // 执行SQL的Dao
+	Table        string        // 表名
+	DbName       string        // 连接名，在事务中执行时为Dao的主库连接名
+	Sql          string        // SQL语句，Before中可以修改
+	Args         []interface{} // SQL参数，Before中可以修改
+	Skip         bool          // Before中设置为true时跳过执行
+	Duration     time.Duration // 执行时间，流式查询不包括读取结果集的时间
+	RowsAffected int64         // 影响的行数，查询时为结果的行数，无法获取时为-1
+	Err          error         // 执行的错误
+}
+
+// Interceptor SQL执行的拦截器
+type Interceptor interface {
+	// Before 执行SQL之前调用，返回的ctx会传递给后续的拦截器与SQL执行
+	Before(ctx context.Context, stmt *Statement) (context.Context, error)
+
+	// After 执行SQL之后调用，Before返回错误时也会调用之前的拦截器
+	After(ctx context.Context, stmt *Statement)
+}
+
+var globalInterceptors []Interceptor
+
+// AddInterceptor 添加全局的拦截器，需要在初始化时设置，不支持并发调用
+func AddInterceptor(interceptors ...Interceptor) {
+	globalInterceptors = append(globalInterceptors, interceptors...)
+}
+
+// AddInterceptor 添加当前Dao的拦截器，在全局的拦截器之后执行
+func (dao *BaseDao) AddInterceptor(interceptors ...Interceptor) {
+	dao.interceptors = append(dao.interceptors, interceptors...)
+}
+
+// getInterceptors 获取Dao需要执行的拦截器，链路追踪在最前，SQL日志在最后执行
+func getInterceptors(dao *BaseDao) []Interceptor {
+	config, t := loggerConfig, tracer
+	if len(dao.interceptors) == 0 && config == nil && t == nil {
+		return globalInterceptors
+	}
+	result := make([]Interceptor, 0, len(globalInterceptors)+len(dao.interceptors)+2)
+	if t != nil {
+		result = append(result, traceInterceptor{tracer: t})
+	}
+	result = append(result, globalInterceptors...)
+	result = append(result, dao.interceptors...)
+	if config != nil {
+		result = append(result, logInterceptor{config: config})
+	}
+	return result
+}
+
+// interceptConn 包装 connectInter，所有的SQL都通过拦截器执行
+type interceptConn struct {
+	conn   connectInter
+	dao    *BaseDao
+	table  string
+	dbName string
+}
+
+func newInterceptConn(conn connectInter, dao *BaseDao, w *Wrapper, dbName string) *interceptConn {
+	table := dao.GetTableName()
+	if w != nil && w.queryInfo.tableName != "" {
+		table = w.queryInfo.tableName
+	}
+	return &interceptConn{conn: conn, dao: dao, table: table, dbName: dbName}
+}
+
+// getStatementKind 通过SQL的第一个关键字获取SQL类型
+func getStatementKind(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	kind := strings.ToLower(fields[0])
+	if kind == "replace" {
+		return StatementInsert
+	}
+	return kind
+}
+
+// execute 执行拦截器与SQL
+func (c *interceptConn) execute(
+	ctx context.Context,
+	query string,
+	args []interface{},
+	fn func(ctx context.Context, stmt *Statement) error,
+) (*Statement, error) {
+	stmt := &Statement{
+		Kind:         getStatementKind(query),
+		Dao:          c.dao,
+		Table:        c.table,
+		DbName:       c.dbName,
+		Sql:          query,
+		Args:         args,
+		RowsAffected: -1,
+	}
+
+	interceptors := getInterceptors(c.dao)
+	called := 0
+	var err error
+	for _, interceptor := range interceptors {
+		ctx, err = interceptor.Before(ctx, stmt)
+		called++
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil && !stmt.Skip {
+		start := time.Now()
+		err = translateError(stmt, fn(ctx, stmt))
+		stmt.Duration = time.Since(start)
+	}
+	stmt.Err = err
+
+	// 被之前的拦截器拒绝时，SQL日志的拦截器没有执行，同样记录被拒绝的SQL
+	if called < len(interceptors) {
+		if logger, ok := interceptors[len(interceptors)-1].(logInterceptor); ok {
+			logger.After(ctx, stmt)
+		}
+	}
+	for i := called - 1; i >= 0; i-- {
+		interceptors[i].After(ctx, stmt)
+	}
+	return stmt, err
+}
+
+func (c *interceptConn) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	_, err := c.execute(ctx, query, args, func(ctx context.Context, stmt *Statement) error {
+		err := c.conn.SelectContext(ctx, dest, stmt.Sql, stmt.Args...)
+		if err == nil {
+			if v := reflect.Indirect(reflect.ValueOf(dest)); v.Kind() == reflect.Slice {
+				stmt.RowsAffected = int64(v.Len())
+			}
+		}
+		return err
+	})
+	return err
+}
+
+func (c *interceptConn) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	stmt, err := c.execute(ctx, query, args, func(ctx context.Context, stmt *Statement) error {
+		err := c.conn.GetContext(ctx, dest, stmt.Sql, stmt.Args...)
+		if err == nil {
+			stmt.RowsAffected = 1
+		} else if errors.Is(err, sql.ErrNoRows) {
+			stmt.RowsAffected = 0
+		}
+		return err
+	})
+	if err == nil && stmt.Skip {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (c *interceptConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	stmt, err := c.execute(ctx, query, args, func(ctx context.Context, stmt *Statement) error {
+		ret, err := c.conn.ExecContext(ctx, stmt.Sql, stmt.Args...)
+		if err != nil {
+			return err
+		}
+		result = ret
+		stmt.RowsAffected, _ = ret.RowsAffected()
+		return nil
+	})
+	if err == nil && stmt.Skip {
+		result = skipResult{rowsAffected: stmt.RowsAffected}
+	}
+	return result, err
+}
+
+func (c *interceptConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	stmt, err := c.execute(ctx, query, args, func(ctx context.Context, stmt *Statement) (err error) {
+		rows, err = c.conn.QueryContext(ctx, stmt.Sql, stmt.Args...)
+		return
+	})
+	if err == nil && stmt.Skip {
+		err = fmt.Errorf("statement is skipped by interceptor, sql: %s", stmt.Sql)
+	}
+	return rows, err
+}
+
+func (c *interceptConn) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	var rows *sqlx.Rows
+	stmt, err := c.execute(ctx, query, args, func(ctx context.Context, stmt *Statement) (err error) {
+		rows, err = c.conn.QueryxContext(ctx, stmt.Sql, stmt.Args...)
+		return
+	})
+	if err == nil && stmt.Skip {
+		err = fmt.Errorf("statement is skipped by interceptor, sql: %s", stmt.Sql)
+	}
+	return rows, err
+}
+
+// skipResult 跳过执行时返回的结果
+type skipResult struct {
+	rowsAffected int64
+}
+
+func (r skipResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (r skipResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
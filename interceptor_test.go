@@ -0,0 +1,82 @@
+package sqlbp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type recordInterceptor struct {
+	name   string
+	events *[]string
+	before func(stmt *Statement) error
+}
+
+func (r recordInterceptor) Before(ctx context.Context, stmt *Statement) (context.Context, error) {
+	*r.events = append(*r.events, r.name+".before "+stmt.Kind+" "+stmt.Table)
+	if r.before != nil {
+		return ctx, r.before(stmt)
+	}
+	return ctx, nil
+}
+
+func (r recordInterceptor) After(ctx context.Context, stmt *Statement) {
+	*r.events = append(*r.events, r.name+".after", stmt.Sql)
+}
+
+func TestInterceptor(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return fakeResult{affected: 2}
+	}, DbMaster)
+	events := make([]string, 0)
+	AddInterceptor(recordInterceptor{name: "global", events: &events})
+	t.Cleanup(func() { globalInterceptors = nil })
+
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName("dev_student")
+	errDenied := errors.New("denied")
+	dao.AddInterceptor(recordInterceptor{name: "dao", events: &events, before: func(stmt *Statement) error {
+		switch stmt.Kind {
+		case StatementUpdate:
+			stmt.Sql += " limit 1"
+		case StatementInsert:
+			stmt.Skip = true
+			stmt.RowsAffected = 5
+		case StatementDelete:
+			return errDenied
+		}
+		return nil
+	}})
+
+	affected, err := dao.UpdateByWrapper(ctx, GetWrapper().Set("name", "a").Eq("id", 1))
+	if err != nil || affected != 2 {
+		t.Errorf("update got %d, %v", affected, err)
+	}
+	result, err := dao.BaseDao.InsertBatch(ctx, []map[string]interface{}{{"name": "a"}}, nil)
+	if err != nil || result.RowsAffected != 5 {
+		t.Errorf("skipped insert got %v, %v", result, err)
+	}
+	if _, err = dao.DeleteById(ctx, 1); !errors.Is(err, errDenied) {
+		t.Errorf("delete should be denied, got %v", err)
+	}
+
+	want := []string{"update dev_student set `name` = ? where `id` = ? limit 1"}
+	if log := dbs[DbMaster].getLog(); !reflect.DeepEqual(log, want) {
+		t.Errorf("interceptor sql\n got: %q\nwant: %q", log, want)
+	}
+	wantEvents := []string{
+		"global.before update dev_student", "dao.before update dev_student",
+		"dao.after", want[0], "global.after", want[0],
+		"global.before insert dev_student", "dao.before insert dev_student",
+		"dao.after", "insert into `dev_student`(`name`) values (?)",
+		"global.after", "insert into `dev_student`(`name`) values (?)",
+		"global.before delete dev_student", "dao.before delete dev_student",
+		"dao.after", "delete from dev_student where `id` = ?",
+		"global.after", "delete from dev_student where `id` = ?",
+	}
+	if !reflect.DeepEqual(events, wantEvents) {
+		t.Errorf("interceptor events\n got: %q\nwant: %q", events, wantEvents)
+	}
+}
@@ -0,0 +1,259 @@
+package sqlbp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+* 游标分页（keyset pagination）
+* 使用上一页最后一条记录的排序字段值作为查询条件，避免深分页时 limit offset, n 扫描大量数据
+* 排序字段的组合必须唯一（一般以主键结尾），且不能为null
+* example:
+*   w := GetWrapper().Eq("class_id", 1).AfterCursor([]string{"create_time desc", "id desc"}, req.Cursor).Limit(20)
+*   next, err := dao.SelectByKeyset(ctx, &list, w)
+ */
+
+type keysetColumn struct {
+	name string
+	desc bool
+}
+
+type keysetInfo struct {
+	columns []keysetColumn
+	values  []interface{} // 上一页最后一条记录的值，为空时表示查询第一页
+}
+
+// newKeysetInfo 解析排序字段，example: []string{"create_time desc", "id"}
+func newKeysetInfo(columns []string, values []interface{}) (*keysetInfo, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("keyset columns is not allow empty")
+	}
+	if len(values) != 0 && len(values) != len(columns) {
+		return nil, fmt.Errorf("keyset values count(%d) is not match columns count(%d)", len(values), len(columns))
+	}
+
+	keyset := &keysetInfo{values: values}
+	for _, column := range columns {
+		parts := strings.Fields(column)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("keyset column format error: %s", column)
+		}
+		item := keysetColumn{name: parts[0]}
+		if len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc":
+			case "desc":
+				item.desc = true
+			default:
+				return nil, fmt.Errorf("keyset column format error: %s", column)
+			}
+		}
+		keyset.columns = append(keyset.columns, item)
+	}
+	return keyset, nil
+}
+
+// orderSql 生成与游标字段对应的 order by 语句
+func (k *keysetInfo) orderSql() string {
+	list := make([]string, 0, len(k.columns))
+	for _, column := range k.columns {
+		if column.desc {
+			list = append(list, keyFormat(column.name)+" desc")
+		} else {
+			list = append(list, keyFormat(column.name))
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// 生成游标分页的where语句
+// 排序方向一致时使用元组比较：(a, b) > (?, ?)
+// 排序方向不一致时展开为：(a < ? or (a = ? and b > ?))
+func getWhereKeysetSql(value interface{}, params *[]interface{}) (result string, err error) {
+	keyset, ok := value.(*keysetInfo)
+	if !ok {
+		err = fmt.Errorf("where keyset format error: %T", value)
+		return
+	}
+	if len(keyset.values) == 0 {
+		return
+	}
+
+	sameDirection := true
+	for _, column := range keyset.columns {
+		if column.desc != keyset.columns[0].desc {
+			sameDirection = false
+			break
+		}
+	}
+
+	if sameDirection {
+		op := ">"
+		if keyset.columns[0].desc {
+			op = "<"
+		}
+		if len(keyset.columns) == 1 {
+			result = fmt.Sprintf("%s %s ?", keyFormat(keyset.columns[0].name), op)
+		} else {
+			fields := make([]string, 0, len(keyset.columns))
+			marks := make([]string, 0, len(keyset.columns))
+			for _, column := range keyset.columns {
+				fields = append(fields, keyFormat(column.name))
+				marks = append(marks, "?")
+			}
+			result = fmt.Sprintf("(%s) %s (%s)", strings.Join(fields, ", "), op, strings.Join(marks, ", "))
+		}
+		*params = append(*params, keyset.values...)
+		return
+	}
+
+	orList := make([]string, 0, len(keyset.columns))
+	for i, column := range keyset.columns {
+		andList := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			andList = append(andList, keyFormat(keyset.columns[j].name)+" = ?")
+			*params = append(*params, keyset.values[j])
+		}
+		op := ">"
+		if column.desc {
+			op = "<"
+		}
+		andList = append(andList, fmt.Sprintf("%s %s ?", keyFormat(column.name), op))
+		*params = append(*params, keyset.values[i])
+
+		if len(andList) == 1 {
+			orList = append(orList, andList[0])
+		} else {
+			orList = append(orList, "("+strings.Join(andList, " and ")+")")
+		}
+	}
+	result = "(" + strings.Join(orList, " or ") + ")"
+	return
+}
+
+// applyKeyset 将游标条件与排序加入到查询条件中
+func applyKeyset(info queryInfo) (queryInfo, error) {
+	if info.keyset == nil {
+		return info, nil
+	}
+	if info.order != "" {
+		return info, fmt.Errorf("order by is not allow in keyset pagination, it is generated by keyset columns")
+	}
+
+	info.where = andWhere(info.where, createWhereItem("", "keyset", info.keyset))
+	info.order = info.keyset.orderSql()
+	info.offset = 0
+	info.page = 0
+	return info, nil
+}
+
+// EncodeCursor 将游标字段的值编码为不透明的字符串，时间统一格式化为MySQL的datetime格式
+func EncodeCursor(values []interface{}) (string, error) {
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok {
+			list[i] = t.Format("2006-01-02 15:04:05.999999")
+		} else if b, ok := value.([]byte); ok {
+			list[i] = string(b)
+		} else {
+			list[i] = value
+		}
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", fmt.Errorf("encode cursor error: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor 解析EncodeCursor生成的游标，整数解析为int64（超出int64的无符号整数为uint64），小数解析为float64
+// 整数不会经过float64转换，超过2^53的ID（example: 雪花ID）不会丢失精度
+func DecodeCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("decode cursor error: %v", err)
+	}
+
+	var list []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&list)
+	if err != nil {
+		return nil, fmt.Errorf("decode cursor error: %v", err)
+	}
+
+	for i, value := range list {
+		number, ok := value.(json.Number)
+		if !ok {
+			continue
+		}
+		if n, err := number.Int64(); err == nil {
+			list[i] = n
+		} else if n, err := strconv.ParseUint(number.String(), 10, 64); err == nil {
+			list[i] = n
+		} else if f, err := number.Float64(); err == nil {
+			list[i] = f
+		}
+	}
+	return list, nil
+}
+
+// getNextCursor 取结果集最后一条记录中游标字段的值，生成下一页的游标
+// dest 为结构体切片或map切片的指针，结构体通过db标签匹配字段
+func getNextCursor(dest interface{}, keyset *keysetInfo) (cursor string, err error) {
+	v := reflect.ValueOf(dest)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		err = fmt.Errorf("keyset dest must be slice, not allow %T", dest)
+		return
+	}
+	if v.Len() == 0 {
+		return
+	}
+
+	last := v.Index(v.Len() - 1)
+	for last.Kind() == reflect.Ptr || last.Kind() == reflect.Interface {
+		last = last.Elem()
+	}
+
+	values := make([]interface{}, 0, len(keyset.columns))
+	for _, column := range keyset.columns {
+		name := getFieldName(column.name)
+		switch last.Kind() {
+		case reflect.Struct:
+			var meta *entityMeta
+			meta, err = getEntityMeta(last.Type())
+			if err != nil {
+				return
+			}
+			field := meta.getField(name)
+			if field == nil {
+				err = fmt.Errorf("keyset column %s is not exist in %s", name, last.Type())
+				return
+			}
+			values = append(values, last.FieldByIndex(field.index).Interface())
+		case reflect.Map:
+			value := last.MapIndex(reflect.ValueOf(name))
+			if !value.IsValid() {
+				err = fmt.Errorf("keyset column %s is not exist in result", name)
+				return
+			}
+			values = append(values, value.Interface())
+		default:
+			err = fmt.Errorf("keyset dest element must be struct or map, not allow %s", last.Type())
+			return
+		}
+	}
+
+	return EncodeCursor(values)
+}
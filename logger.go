@@ -0,0 +1,268 @@
+package sqlbp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+/*
+* SQL日志，通过拦截器记录每一条SQL，在所有拦截器之后执行，记录的是最终执行的SQL
+* 普通SQL为Info级别，慢查询为Warn级别，执行失败为Error级别，慢查询与执行失败会记录调用Dao方法的文件与行号
+* 敏感字段的参数会被替换为 RedactValue，参数与字段的对应关系通过SQL中的 `字段名` 推断，Apply等原生SQL中的参数无法识别
+* 被拦截器拒绝（Before返回错误）的SQL同样会记录，日志级别为Error，Duration为0
+* 注意：生成SQL之前的错误（example: ErrTenantMissing、ErrTxMismatch、Wrapper的错误）没有对应的SQL，不会记录日志
+ */
+
+type LogLevel int
+
+const (
+	LogLevelInfo LogLevel = iota
+	LogLevelWarn
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// LogEntry 一条SQL日志
+type LogEntry struct {
+	Kind     string        // SQL类型：select / insert / update / delete
+	DbName   string        // 连接名
+	Table    string        // 表名
+	Sql      string        // SQL语句
+	Args     []interface{} // SQL参数，敏感字段已替换
+	Duration time.Duration // 执行时间
+	Rows     int64         // 影响或查询的行数，无法获取时为-1
+	Err      error         // 执行的错误
+	Slow     bool          // 是否为慢查询
+	Caller   string        // 调用Dao方法的文件与行号，只有慢查询与执行失败时记录
+}
+
+// Logger SQL日志的输出接口
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, entry *LogEntry)
+}
+
+// LoggerConfig SQL日志的设置
+type LoggerConfig struct {
+	Logger        Logger
+	Level         LogLevel      // 最低的日志级别，example: LogLevelWarn 只记录慢查询与执行失败的SQL
+	SlowThreshold time.Duration // 慢查询的阈值，为0时不记录慢查询
+	RedactColumns []string      // 需要脱敏的字段，example: password, id_card
+	RedactValue   string        // 脱敏后的参数，默认为 ***
+}
+
+var loggerConfig *LoggerConfig
+
+// SetLogger 设置全局的SQL日志，config为nil时关闭
+func SetLogger(config *LoggerConfig) {
+	loggerConfig = config
+}
+
+// logInterceptor 记录SQL日志的拦截器
+type logInterceptor struct {
+	config *LoggerConfig
+}
+
+func (l logInterceptor) Before(ctx context.Context, stmt *Statement) (context.Context, error) {
+	return ctx, nil
+}
+
+func (l logInterceptor) After(ctx context.Context, stmt *Statement) {
+	level := LogLevelInfo
+	slow := l.config.SlowThreshold > 0 && stmt.Duration >= l.config.SlowThreshold
+	if stmt.Err != nil {
+		level = LogLevelError
+	} else if slow {
+		level = LogLevelWarn
+	}
+	if level < l.config.Level {
+		return
+	}
+
+	entry := &LogEntry{
+		Kind:     stmt.Kind,
+		DbName:   stmt.DbName,
+		Table:    stmt.Table,
+		Sql:      stmt.Sql,
+		Args:     redactArgs(stmt.Sql, stmt.Args, l.config),
+		Duration: stmt.Duration,
+		Rows:     stmt.RowsAffected,
+		Err:      stmt.Err,
+		Slow:     slow,
+	}
+	if level > LogLevelInfo {
+		entry.Caller = getCaller()
+	}
+	l.config.Logger.Log(ctx, level, entry)
+}
+
+// redactArgs 替换敏感字段的参数
+func redactArgs(sql string, args []interface{}, config *LoggerConfig) []interface{} {
+	if len(config.RedactColumns) == 0 || len(args) == 0 {
+		return args
+	}
+
+	value := config.RedactValue
+	if value == "" {
+		value = "***"
+	}
+	result := make([]interface{}, len(args))
+	copy(result, args)
+	for i, column := range getArgColumns(sql) {
+		if i >= len(result) {
+			break
+		}
+		for _, redact := range config.RedactColumns {
+			if strings.EqualFold(column, redact) {
+				result[i] = value
+				break
+			}
+		}
+	}
+	return result
+}
+
+// getArgColumns 推断SQL中每个占位符对应的字段
+// 占位符对应之前最近的 `字段名`，insert的values中按字段列表对应，case when中 then 的参数对应 set 的字段
+func getArgColumns(sql string) []string {
+	result := make([]string, 0)
+	isInsert := getStatementKind(sql) == StatementInsert
+	insertColumns := make([]string, 0)
+	inValues, valuesDone := false, false
+	valueIndex, depth := 0, 0
+	var lastColumn, caseColumn, lastWord string
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '`':
+			end := strings.IndexByte(sql[i+1:], '`')
+			if end < 0 {
+				return result
+			}
+			lastColumn = sql[i+1 : i+1+end]
+			if isInsert && !valuesDone && depth == 1 {
+				insertColumns = append(insertColumns, lastColumn)
+			}
+			i += end + 1
+		case c == '\'' || c == '"':
+			// 跳过字符串
+			for i++; i < len(sql) && sql[i] != c; i++ {
+				if sql[i] == '\\' {
+					i++
+				}
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '?':
+			column := lastColumn
+			if inValues && len(insertColumns) > 0 {
+				column = insertColumns[valueIndex%len(insertColumns)]
+				valueIndex++
+			} else if caseColumn != "" && lastWord == "then" {
+				column = caseColumn
+			}
+			result = append(result, column)
+		case isWordChar(c):
+			start := i
+			for i+1 < len(sql) && isWordChar(sql[i+1]) {
+				i++
+			}
+			lastWord = strings.ToLower(sql[start : i+1])
+			switch lastWord {
+			case "values":
+				if isInsert && !valuesDone {
+					inValues, valuesDone = true, true
+				}
+			case "on":
+				inValues = false
+			case "case":
+				caseColumn = lastColumn
+			case "end":
+				caseColumn = ""
+			}
+		}
+	}
+	return result
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// loggerPackageDir 当前包所在的目录，用于查找调用方
+var loggerPackageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// getCaller 获取调用Dao方法的文件与行号，跳过本包中的调用
+func getCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		inPackage := filepath.Dir(frame.File) == loggerPackageDir && !strings.HasSuffix(frame.File, "_test.go")
+		if !inPackage && !strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// slogLogger 使用 log/slog 输出SQL日志
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger 创建使用 log/slog 输出的Logger，logger为nil时使用slog.Default()
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return slogLogger{logger: logger}
+}
+
+func (s slogLogger) Log(ctx context.Context, level LogLevel, entry *LogEntry) {
+	attrs := []slog.Attr{
+		slog.String("db", entry.DbName),
+		slog.String("table", entry.Table),
+		slog.String("sql", entry.Sql),
+		slog.Any("args", entry.Args),
+		slog.Duration("duration", entry.Duration),
+		slog.Int64("rows", entry.Rows),
+	}
+	if entry.Caller != "" {
+		attrs = append(attrs, slog.String("caller", entry.Caller))
+	}
+
+	msg := "sqlbp"
+	slogLevel := slog.LevelInfo
+	switch level {
+	case LogLevelWarn:
+		msg, slogLevel = "sqlbp slow sql", slog.LevelWarn
+	case LogLevelError:
+		msg, slogLevel = "sqlbp sql error", slog.LevelError
+		attrs = append(attrs, slog.Any("error", entry.Err))
+	}
+	s.logger.LogAttrs(ctx, slogLevel, msg, attrs...)
+}
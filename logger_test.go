@@ -0,0 +1,94 @@
+package sqlbp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type captureLogger struct {
+	levels  []LogLevel
+	entries []*LogEntry
+}
+
+func (c *captureLogger) Log(ctx context.Context, level LogLevel, entry *LogEntry) {
+	c.levels = append(c.levels, level)
+	c.entries = append(c.entries, entry)
+}
+
+func TestArgColumns(t *testing.T) {
+	cases := map[string][]string{
+		"update dev_user set `password` = ? where `a`.`id` in (?, ?) and `age` between ? and ?": {"password", "id", "id", "age", "age"},
+		"insert into `dev_user`(`name`, `password`) values (?, ?), (?, ?) on duplicate key update `password` = values(`password`), `age` = ?": {
+			"name", "password", "name", "password", "age",
+		},
+		"update `dev_user` set `password` = case `id` when ? then ? when ? then ? end where `id` in (?, ?)": {
+			"id", "password", "id", "password", "id", "id",
+		},
+		"select * from dev_user where `name` = 'a?' and `password` = ?": {"password"},
+	}
+	for sql, want := range cases {
+		if got := getArgColumns(sql); !reflect.DeepEqual(got, want) {
+			t.Errorf("arg columns of %s\n got: %q\nwant: %q", sql, got, want)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return fakeResult{affected: 1}
+	}, DbMaster)
+	logger := &captureLogger{}
+	SetLogger(&LoggerConfig{Logger: logger, RedactColumns: []string{"name"}})
+	t.Cleanup(func() { SetLogger(nil) })
+
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName("dev_student")
+	_, _ = dao.UpdateByWrapper(ctx, GetWrapper().Set("name", "tom").Set("age", 10).Eq("id", 1))
+
+	if len(logger.entries) != 1 || logger.levels[0] != LogLevelInfo {
+		t.Fatalf("logger got %v", logger.levels)
+	}
+	entry := logger.entries[0]
+	if !reflect.DeepEqual(entry.Args, []interface{}{"***", 10, 1}) || entry.DbName != DbMaster ||
+		entry.Table != "dev_student" || entry.Rows != 1 || entry.Caller != "" {
+		t.Errorf("log entry got %+v", entry)
+	}
+
+	// 只记录慢查询
+	logger = &captureLogger{}
+	SetLogger(&LoggerConfig{Logger: logger, Level: LogLevelWarn, SlowThreshold: time.Nanosecond})
+	_, _ = dao.DeleteById(ctx, 1)
+	if len(logger.entries) != 1 || logger.levels[0] != LogLevelWarn || !logger.entries[0].Slow {
+		t.Fatalf("slow logger got %v", logger.levels)
+	}
+	if !strings.Contains(logger.entries[0].Caller, "logger_test.go:") {
+		t.Errorf("slow sql caller got %s", logger.entries[0].Caller)
+	}
+
+	// 被拦截器拒绝的SQL同样记录日志
+	logger = &captureLogger{}
+	SetLogger(&LoggerConfig{Logger: logger})
+	errDenied := errors.New("denied")
+	dao.AddInterceptor(recordInterceptor{name: "deny", events: &[]string{}, before: func(stmt *Statement) error {
+		return errDenied
+	}})
+	_, _ = dao.DeleteById(ctx, 3)
+	if len(logger.entries) != 1 || logger.levels[0] != LogLevelError || !errors.Is(logger.entries[0].Err, errDenied) {
+		t.Fatalf("denied logger got %v", logger.levels)
+	}
+	dao.interceptors = nil
+
+	buffer := bytes.Buffer{}
+	SetLogger(&LoggerConfig{Logger: NewSlogLogger(slog.New(slog.NewTextHandler(&buffer, nil)))})
+	_, _ = dao.DeleteById(ctx, 2)
+	if out := buffer.String(); !strings.Contains(out, "level=INFO") || !strings.Contains(out, "sql=\"delete from dev_student") {
+		t.Errorf("slog output got %s", out)
+	}
+}
@@ -0,0 +1,109 @@
+package sqlbp
+
+import (
+	"fmt"
+)
+
+/*
+* 逻辑删除
+* 开启后，删除操作会转为更新逻辑删除字段，查询、统计与更新操作会自动加上 `deleted` = 未删除值 的条件
+* 可以通过 Wrapper.WithDeleted 查询包含已删除的记录，Wrapper.OnlyDeleted 只查询已删除的记录
+* 泛型Dao可以通过实体的标签开启：`db:"deleted" sqlbp:"logic_delete"`，
+* 默认已删除的值为1，未删除的值为0，也可以在标签中指定：`sqlbp:"logic_delete,deleted=1,not_deleted=0"`
+ */
+
+const (
+	logicDeleteNormal  = iota // 只查询未删除的记录（默认）
+	logicDeleteAll            // 查询包括已删除的所有记录
+	logicDeleteDeleted        // 只查询已删除的记录
+)
+
+type logicDeleteConfig struct {
+	column          string
+	deletedValue    interface{}
+	notDeletedValue interface{}
+}
+
+// SetLogicDelete 开启逻辑删除，column为逻辑删除字段，deletedValue与notDeletedValue为已删除与未删除时的值
+func (dao *BaseDao) SetLogicDelete(column string, deletedValue interface{}, notDeletedValue interface{}) {
+	dao.logicDelete = &logicDeleteConfig{
+		column:          column,
+		deletedValue:    deletedValue,
+		notDeletedValue: notDeletedValue,
+	}
+}
+
+// IsLogicDelete 是否开启了逻辑删除
+func (dao *BaseDao) IsLogicDelete() bool {
+	return dao.logicDelete != nil
+}
+
+// setLogicDeleteByMeta 根据实体标签开启逻辑删除
+func (dao *BaseDao) setLogicDeleteByMeta(meta *entityMeta) {
+	for _, field := range meta.fields {
+		if _, ok := field.options["logic_delete"]; !ok {
+			continue
+		}
+
+		var deletedValue, notDeletedValue interface{} = 1, 0
+		if value, ok := field.options["deleted"]; ok {
+			deletedValue = value
+		}
+		if value, ok := field.options["not_deleted"]; ok {
+			notDeletedValue = value
+		}
+		dao.SetLogicDelete(field.column, deletedValue, notDeletedValue)
+		return
+	}
+}
+
+// withLogicDelete 在查询条件中加入逻辑删除的过滤条件
+// 使用了其它表名或者派生表时，查询的不是dao对应的表，不作处理
+func withLogicDelete(dao *BaseDao, info queryInfo) queryInfo {
+	config := dao.logicDelete
+	if config == nil || info.logicDeleteMode == logicDeleteAll {
+		return info
+	}
+	if info.fromSub != nil || (info.tableName != "" && info.tableName != dao.GetTableName()) {
+		return info
+	}
+
+	column := config.column
+	if info.as != "" {
+		column = info.as + "." + column
+	}
+	value := config.notDeletedValue
+	if info.logicDeleteMode == logicDeleteDeleted {
+		value = config.deletedValue
+	}
+
+	info.where = andWhere(info.where, createWhereItem(column, "=", value))
+	return info
+}
+
+// logicDeleteByWrapper 逻辑删除，将满足条件且未删除的记录更新为已删除
+func logicDeleteByWrapper(w *Wrapper, config *logicDeleteConfig) (*Wrapper, error) {
+	// 与物理删除一样，不支持全表删除
+	if len(w.queryInfo.where) == 0 {
+		return nil, fmt.Errorf("not support delete all records from tableName")
+	}
+
+	update := GetWrapper()
+	update.queryInfo = w.queryInfo
+	update.queryInfo.logicDeleteMode = logicDeleteNormal
+	update.Set(config.column, config.deletedValue)
+	return update, nil
+}
+
+// restoreByWrapper 恢复逻辑删除的记录，将满足条件且已删除的记录更新为未删除
+func restoreByWrapper(w *Wrapper, config *logicDeleteConfig) (*Wrapper, error) {
+	if len(w.queryInfo.where) == 0 {
+		return nil, fmt.Errorf("not support restore all records from tableName")
+	}
+
+	update := GetWrapper()
+	update.queryInfo = w.queryInfo
+	update.queryInfo.logicDeleteMode = logicDeleteDeleted
+	update.Set(config.column, config.notDeletedValue)
+	return update, nil
+}
@@ -0,0 +1,63 @@
+package sqlbp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type devArticleEntity struct {
+	Id      int64  `db:"id"`
+	Title   string `db:"title"`
+	Deleted int    `db:"deleted" sqlbp:"logic_delete"`
+}
+
+func TestLogicDelete(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		if isSelect(query) {
+			return fakeResult{columns: []string{"cn"}, rows: studentRows(1).rows[:1:1]}
+		}
+		return fakeResult{affected: 1}
+	}, DbMaster)
+	ctx := context.Background()
+	dao := MustNewDao[devArticleEntity](DbMaster)
+	if !dao.IsLogicDelete() {
+		t.Fatal("logic delete should be set by tag")
+	}
+
+	_, _ = dao.DeleteById(ctx, 1)
+	_, _ = dao.DeleteByWrapper(ctx, GetWrapper().Eq("title", "a").Or().Eq("title", "b"))
+	_, _ = dao.RestoreById(ctx, 1)
+	_, _ = dao.UpdateByWrapper(ctx, GetWrapper().Set("title", "c").Eq("id", 2))
+	_, _ = dao.Count(ctx, GetWrapper().Gt("id", 1))
+	_, _ = dao.Count(ctx, GetWrapper().Gt("id", 1).OnlyDeleted())
+	_, _ = dao.Count(ctx, GetWrapper().Gt("id", 1).WithDeleted())
+	_, _ = dao.Count(ctx, GetWrapper().As("a").Join("left join dev_user as u on a.uid = u.id"))
+	_, _ = dao.UpdateBatchById(ctx, []devArticleEntity{{Id: 1, Title: "x"}}, nil, "title")
+
+	want := []string{
+		"update dev_article set `deleted` = ? where `id` = ? and `deleted` = ?",
+		"update dev_article set `deleted` = ? where (`title` = ? or `title` = ?) and `deleted` = ?",
+		"update dev_article set `deleted` = ? where `id` = ? and `deleted` = ?",
+		"update dev_article set `title` = ? where `id` = ? and `deleted` = ?",
+		"select count(1) as cn from dev_article where `id` > ? and `deleted` = ?",
+		"select count(1) as cn from dev_article where `id` > ? and `deleted` = ?",
+		"select count(1) as cn from dev_article where `id` > ?",
+		"select count(1) as cn from dev_article a  left join dev_user as u on a.uid = u.id where `a`.`deleted` = ?",
+		"update `dev_article` set `title` = case `id` when ? then ? end where `id` in (?) and `deleted` = ?",
+	}
+	log := dbs[DbMaster].getLog()
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("logic delete sql\n got: %q\nwant: %q", log, want)
+	}
+	if args := dbs[DbMaster].args[2]; !reflect.DeepEqual(args, []interface{}{int64(0), int64(1), int64(1)}) {
+		t.Errorf("restore args got %v", args)
+	}
+	if args := dbs[DbMaster].args[5]; !reflect.DeepEqual(args, []interface{}{int64(1), int64(1)}) {
+		t.Errorf("only deleted args got %v", args)
+	}
+
+	if _, err := dao.DeleteByWrapper(ctx, GetWrapper()); err == nil {
+		t.Errorf("logic delete all records should fail")
+	}
+}
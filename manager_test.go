@@ -122,6 +122,21 @@ func TestGoBatisPlus(t *testing.T) {
 	affect, err = GDevStudentDao.DeleteById(ctx, "id", id)
 	dbLog(t, err, "delete_one, affect=%d", affect)
 
+	// 泛型Dao的增删改查
+	studentDao := MustNewDao[DevStudentEntity](DbMaster)
+	student := DevStudentEntity{Name: "test_typed", Age: 18, ClassId: 1, CreateTime: time.Now()}
+	id, err = studentDao.Insert(ctx, &student)
+	dbLog(t, err, "typed_insert, id=%d, student.id=%d", id, student.Id)
+	student.Age += 1
+	affect, err = studentDao.UpdateById(ctx, &student)
+	dbLog(t, err, "typed_update, affect=%d", affect)
+	pStudent, err := studentDao.GetById(ctx, student.Id)
+	dbLog(t, err, "typed_get, res=%v", pStudent)
+	studentPage, err := studentDao.SelectPage(ctx, GetWrapper().Eq("age", 19).Limit(10))
+	dbLog(t, err, "typed_page, page=%+v", studentPage)
+	affect, err = studentDao.DeleteById(ctx, student.Id)
+	dbLog(t, err, "typed_delete, affect=%d", affect)
+
 	// Wrapper 单表查询
 	var tGet []DevStudentEntity
 	// use Eq
@@ -152,6 +167,12 @@ func TestGoBatisPlus(t *testing.T) {
 	mMap, err := GDevStudentDao.SelectMapByWrapper(ctx, mWrap)
 	dbLog(t, err, "select_map, res json=%v", mMap)
 
+	// Wrapper 分页查询
+	tGet = make([]DevStudentEntity, 0)
+	wPage := GetWrapper().Gt("age", 10).Order("id desc").Page(2).Limit(10)
+	page, err := GDevStudentDao.SelectPage(ctx, &tGet, wPage)
+	dbLog(t, err, "select_page, total=%d, pages=%d, data=%v", page.Total, page.Pages, tGet)
+
 	// Wrapper 查询条数
 	wCount := GetWrapper().Eq("age", 100)
 	affect, err = GDevStudentDao.CountByWrapper(ctx, wCount)
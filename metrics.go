@@ -0,0 +1,162 @@
+package sqlbp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*
+* Prometheus监控，MetricsCollector既是Collector也是拦截器
+* example:
+*	collector := sqlbp.NewMetricsCollector(nil)
+*	prometheus.MustRegister(collector)
+*	sqlbp.AddInterceptor(collector)
+ */
+
+// MetricsOptions 监控的设置
+type MetricsOptions struct {
+	Namespace string    // 指标的前缀，默认为 sqlbp
+	Buckets   []float64 // 执行时间的分布，单位为秒，默认为 prometheus.DefBuckets
+}
+
+// MetricsCollector 导出SQL执行的次数、时间、错误，以及 InitDbConnectMap 中所有连接池的状态
+type MetricsCollector struct {
+	queries  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func NewMetricsCollector(opts *MetricsOptions) *MetricsCollector {
+	namespace, buckets := "sqlbp", prometheus.DefBuckets
+	if opts != nil && opts.Namespace != "" {
+		namespace = opts.Namespace
+	}
+	if opts != nil && len(opts.Buckets) > 0 {
+		buckets = opts.Buckets
+	}
+
+	labels := []string{"db", "table", "operation"}
+	poolDesc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", name), help, []string{"db"}, nil)
+	}
+	return &MetricsCollector{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "queries_total",
+			Help:      "Total number of executed statements.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Duration of executed statements in seconds.",
+			Buckets:   buckets,
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "query_errors_total",
+			Help:      "Total number of failed statements by error class.",
+		}, append(labels, "class")),
+
+		maxOpen:           poolDesc("max_open_connections", "Maximum number of open connections to the database."),
+		open:              poolDesc("open_connections", "The number of established connections both in use and idle."),
+		inUse:             poolDesc("in_use_connections", "The number of connections currently in use."),
+		idle:              poolDesc("idle_connections", "The number of idle connections."),
+		waitCount:         poolDesc("wait_count_total", "The total number of connections waited for."),
+		waitDuration:      poolDesc("wait_duration_seconds_total", "The total time blocked waiting for a new connection."),
+		maxIdleClosed:     poolDesc("max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns."),
+		maxIdleTimeClosed: poolDesc("max_idle_time_closed_total", "The total number of connections closed due to SetConnMaxIdleTime."),
+		maxLifetimeClosed: poolDesc("max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime."),
+	}
+}
+
+func (m *MetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	m.queries.Describe(ch)
+	m.duration.Describe(ch)
+	m.errors.Describe(ch)
+	for _, desc := range []*prometheus.Desc{
+		m.maxOpen, m.open, m.inUse, m.idle, m.waitCount, m.waitDuration,
+		m.maxIdleClosed, m.maxIdleTimeClosed, m.maxLifetimeClosed,
+	} {
+		ch <- desc
+	}
+}
+
+func (m *MetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	m.queries.Collect(ch)
+	m.duration.Collect(ch)
+	m.errors.Collect(ch)
+
+	for name, db := range linkMap {
+		stats := db.Stats()
+		gauge := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, name)
+		}
+		counter := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, name)
+		}
+		gauge(m.maxOpen, float64(stats.MaxOpenConnections))
+		gauge(m.open, float64(stats.OpenConnections))
+		gauge(m.inUse, float64(stats.InUse))
+		gauge(m.idle, float64(stats.Idle))
+		counter(m.waitCount, float64(stats.WaitCount))
+		counter(m.waitDuration, stats.WaitDuration.Seconds())
+		counter(m.maxIdleClosed, float64(stats.MaxIdleClosed))
+		counter(m.maxIdleTimeClosed, float64(stats.MaxIdleTimeClosed))
+		counter(m.maxLifetimeClosed, float64(stats.MaxLifetimeClosed))
+	}
+}
+
+func (m *MetricsCollector) Before(ctx context.Context, stmt *Statement) (context.Context, error) {
+	return ctx, nil
+}
+
+func (m *MetricsCollector) After(ctx context.Context, stmt *Statement) {
+	if stmt.Skip {
+		return
+	}
+	m.queries.WithLabelValues(stmt.DbName, stmt.Table, stmt.Kind).Inc()
+	m.duration.WithLabelValues(stmt.DbName, stmt.Table, stmt.Kind).Observe(stmt.Duration.Seconds())
+	if class := getErrorClass(stmt.Err); class != "" {
+		m.errors.WithLabelValues(stmt.DbName, stmt.Table, stmt.Kind, class).Inc()
+	}
+}
+
+// getErrorClass 错误的分类，用于监控的标签，查询不到数据不算错误
+func getErrorClass(err error) string {
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case err == nil || errors.Is(err, sql.ErrNoRows):
+		return ""
+	case errors.Is(err, ErrDuplicateKey):
+		return "duplicate_key"
+	case errors.Is(err, ErrDeadlock):
+		return "deadlock"
+	case errors.Is(err, ErrLockWaitTimeout):
+		return "lock_wait_timeout"
+	case errors.Is(err, ErrForeignKey):
+		return "foreign_key"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn):
+		return "bad_conn"
+	case errors.As(err, &mysqlErr):
+		return "mysql"
+	}
+	return "other"
+}
@@ -0,0 +1,42 @@
+package sqlbp
+
+import (
+	"context"
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		if query == "delete from dev_student where `id` = ?" {
+			return fakeResult{err: &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}}
+		}
+		return fakeResult{affected: 1}
+	}, DbMaster, DbSlave)
+	collector := NewMetricsCollector(nil)
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName("dev_student")
+	dao.AddInterceptor(collector)
+	_, _ = dao.UpdateByWrapper(ctx, GetWrapper().Set("name", "a").Eq("id", 1))
+	_, _ = dao.UpdateByWrapper(ctx, GetWrapper().Set("name", "b").Eq("id", 2))
+	_, _ = dao.DeleteById(ctx, 1)
+
+	if v := testutil.ToFloat64(collector.queries.WithLabelValues(DbMaster, "dev_student", "update")); v != 2 {
+		t.Errorf("update count got %v", v)
+	}
+	if v := testutil.ToFloat64(collector.errors.WithLabelValues(DbMaster, "dev_student", "delete", "deadlock")); v != 1 {
+		t.Errorf("deadlock count got %v", v)
+	}
+	if n := testutil.CollectAndCount(collector, "sqlbp_pool_open_connections"); n != 2 {
+		t.Errorf("pool metrics got %d", n)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Errorf("gather got %v", err)
+	}
+}
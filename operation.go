@@ -3,6 +3,7 @@ package sqlbp
 import (
 	"context"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"reflect"
 	"strings"
 )
@@ -21,6 +22,12 @@ type dataItem struct {
 	value interface{}
 }
 
+// rawSql 原生SQL片段及其绑定参数，用于 in 子查询
+type rawSql struct {
+	sql  string
+	args []interface{}
+}
+
 type queryInfo struct {
 	// 查询字段，默认是 *
 	selectField []string
@@ -41,6 +48,9 @@ type queryInfo struct {
 	//取默认 是dao.GetTableName() 也可以自己赋值
 	tableName string
 
+	// 作为派生表的子查询，设置后会取代tableName，生成 from (子查询) as 别名
+	fromSub *Wrapper
+
 	// having查询语句
 	having string
 
@@ -61,12 +71,39 @@ type queryInfo struct {
 
 	// 强制使用主库查询
 	queryUseMaster bool
+
+	// 游标分页的字段与上一页最后一条记录的值，设置后order、offset与page不再生效
+	keyset *keysetInfo
+
+	// 逻辑删除的查询范围，详情请参考logicDeleteNormal
+	logicDeleteMode int
+
+	// 分页查询时不执行count
+	skipCount bool
+
+	// 分页查询时使用的总条数缓存，大于0时不再执行count
+	cachedTotal int64
 }
 
 func createWhereItem(field string, op string, value interface{}) whereItem {
 	return whereItem{field: field, op: op, value: value}
 }
 
+// andWhere 在查询条件后面用and追加条件，原有条件中有or时，将其作为一个整体用括号包裹
+func andWhere(where []whereItem, items ...whereItem) []whereItem {
+	result := make([]whereItem, 0, len(where)+len(items))
+	for _, item := range where {
+		if item.op == "or" {
+			result = append(result, createWhereItem("", "nested", where))
+			break
+		}
+	}
+	if len(result) == 0 {
+		result = append(result, where...)
+	}
+	return append(result, items...)
+}
+
 // selectByWrapper 执行多条数据的查询请求
 // note: 查询结果不支持null，如果数据库中有null，请使用NullToEmpty或NullToZero转换一下
 func selectByWrapper(
@@ -80,7 +117,11 @@ func selectByWrapper(
 		return
 	}
 
-	sql, params, err := getSelectSql(dao.GetTableName(), w.queryInfo)
+	query, err := prepareQueryInfo(ctx, dao, w.queryInfo)
+	if err != nil {
+		return
+	}
+	sql, params, err := getSelectSql(dao.GetTableName(), query)
 	if err != nil {
 		return
 	}
@@ -104,7 +145,11 @@ func selectMapByWrapper(
 		return
 	}
 
-	sql, params, err := getSelectSql(dao.GetTableName(), w.queryInfo)
+	query, err := prepareQueryInfo(ctx, dao, w.queryInfo)
+	if err != nil {
+		return
+	}
+	sql, params, err := getSelectSql(dao.GetTableName(), query)
 	if err != nil {
 		return
 	}
@@ -150,6 +195,56 @@ func selectMapByWrapper(
 	return
 }
 
+// queryRowsByWrapper 执行查询，返回未读取的结果集，用于流式读取大量数据
+// 注意：与selectByWrapper不同，没有设置Limit时不会添加默认的limit
+func queryRowsByWrapper(
+	ctx context.Context,
+	dao *BaseDao,
+	w *Wrapper,
+) (rows *sqlx.Rows, err error) {
+	connect, err := getConnectByWrapper(ctx, dao, w, false)
+	if err != nil {
+		return
+	}
+
+	query, err := prepareQueryInfo(ctx, dao, w.queryInfo)
+	if err != nil {
+		return
+	}
+	sql, params, err := buildSelectSql(dao.GetTableName(), query, 0)
+	if err != nil {
+		return
+	}
+
+	return connect.QueryxContext(ctx, sql, params...)
+}
+
+// iterateByWrapper 逐行读取查询结果，fn返回错误或ctx被取消时停止读取
+func iterateByWrapper(
+	ctx context.Context,
+	dao *BaseDao,
+	w *Wrapper,
+	fn func(rows *sqlx.Rows) error,
+) (err error) {
+	rows, err := queryRowsByWrapper(ctx, dao, w)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err = ctx.Err()
+		if err != nil {
+			return
+		}
+		err = fn(rows)
+		if err != nil {
+			return
+		}
+	}
+	return translateDriverError(rows.Err())
+}
+
 // getOneData 通过ID查询单条记录（ID可以是表中的任何字段）
 func getOneData(
 	ctx context.Context,
@@ -158,14 +253,17 @@ func getOneData(
 	idKey string,
 	id interface{},
 ) (err error) {
-	dbName := dao.GetSlaveDbName()
-	connect, err := getDbConnect(dbName)
+	connect, err := getConnectByWrapper(ctx, dao, nil, false)
 	if err != nil {
 		return
 	}
 
 	var query queryInfo
 	query.where = []whereItem{createWhereItem(idKey, "=", id)}
+	query, err = prepareQueryInfo(ctx, dao, query)
+	if err != nil {
+		return
+	}
 	sql, params, err := getSelectOneSql(dao, query)
 	if err != nil {
 		return
@@ -189,10 +287,11 @@ func countByWrapper(
 		return
 	}
 
-	// 注意，w是作为输入参数使用的，不能直接改w.queryInfo，
-	query := w.queryInfo
-	query.selectField = []string{"count(1) as cn"}
-	sql, params, err := getSelectOneSql(dao, query)
+	query, err := prepareQueryInfo(ctx, dao, w.queryInfo)
+	if err != nil {
+		return
+	}
+	sql, params, err := getCountSql(dao.GetTableName(), query)
 	if err != nil {
 		return
 	}
@@ -204,6 +303,64 @@ func countByWrapper(
 	return
 }
 
+// selectPageByWrapper 分页查询，查询结果写入dest，同时返回总条数与分页信息
+func selectPageByWrapper(
+	ctx context.Context,
+	dest interface{},
+	dao *BaseDao,
+	w *Wrapper,
+) (page Page, err error) {
+	page = newPage(dest, w.queryInfo)
+
+	if w.queryInfo.cachedTotal > 0 {
+		page.setTotal(w.queryInfo.cachedTotal)
+	} else if !w.queryInfo.skipCount {
+		var total int64
+		total, err = countByWrapper(ctx, dao, w)
+		if err != nil {
+			return
+		}
+		page.setTotal(total)
+
+		// 没有数据或者超出最后一页时不再查询记录
+		if total == 0 || page.Current > page.Pages {
+			return
+		}
+	}
+
+	err = selectByWrapper(ctx, dest, dao, w)
+	return
+}
+
+// selectByKeyset 游标分页查询，返回下一页的游标，没有更多数据时游标为空
+func selectByKeyset(
+	ctx context.Context,
+	dest interface{},
+	dao *BaseDao,
+	w *Wrapper,
+) (nextCursor string, err error) {
+	keyset := w.queryInfo.keyset
+	if keyset == nil {
+		err = fmt.Errorf("keyset is not set, please use Wrapper.After or Wrapper.AfterCursor")
+		return
+	}
+
+	err = selectByWrapper(ctx, dest, dao, w)
+	if err != nil {
+		return
+	}
+
+	// 结果集不满一页时说明没有更多数据了
+	limit := w.queryInfo.limit
+	if limit == 0 {
+		limit = 1024
+	}
+	if int64(reflect.Indirect(reflect.ValueOf(dest)).Len()) < limit {
+		return
+	}
+	return getNextCursor(dest, keyset)
+}
+
 // insertByWrapper 插入数据
 func insertByWrapper(
 	ctx context.Context,
@@ -215,8 +372,13 @@ func insertByWrapper(
 		return
 	}
 
+	dataItems, err := withTenantInsert(ctx, dao, w.dataItems)
+	if err != nil {
+		return
+	}
+
 	params := make([]interface{}, 0)
-	sql, err := getInsertSql(dao, w.dataItems, &params)
+	sql, err := getInsertSql(dao, dataItems, &params)
 	if err != nil {
 		return
 	}
@@ -234,19 +396,37 @@ func insertByWrapper(
 	return
 }
 
-// deleteByWrapper 删除数据
+// deleteByWrapper 删除数据，开启了逻辑删除时转为更新逻辑删除字段
 func deleteByWrapper(
 	ctx context.Context,
 	dao *BaseDao,
 	w *Wrapper,
 ) (affectedRow int64, err error) {
+	if dao.logicDelete != nil {
+		w, err = logicDeleteByWrapper(w, dao.logicDelete)
+		if err != nil {
+			return
+		}
+		return updateByWrapper(ctx, dao, w)
+	}
+
 	connect, err := getConnectByWrapper(ctx, dao, w, true)
 	if err != nil {
 		return
 	}
 
+	// 不支持全表删除，需要在加入租户条件之前判断
+	if len(w.queryInfo.where) == 0 {
+		err = fmt.Errorf("not support delete all records from tableName")
+		return
+	}
+	query, err := prepareQueryInfo(ctx, dao, w.queryInfo)
+	if err != nil {
+		return
+	}
+
 	params := make([]interface{}, 0)
-	sql, err := getDeleteSql(dao, w.queryInfo.where, &params)
+	sql, err := getDeleteSql(dao, query.where, &params)
 	if err != nil {
 		return
 	}
@@ -275,8 +455,22 @@ func updateByWrapper(
 		return
 	}
 
+	// 不支持全表更新，需要在加入逻辑删除与租户条件之前判断
+	if len(w.queryInfo.where) == 0 {
+		err = fmt.Errorf("not support update all records from tableName")
+		return
+	}
+	query, err := prepareQueryInfo(ctx, dao, w.queryInfo)
+	if err != nil {
+		return
+	}
+	dataItems, err := withoutTenantData(ctx, dao, w.dataItems)
+	if err != nil {
+		return
+	}
+
 	params := make([]interface{}, 0)
-	sql, err := getUpdateSql(dao, w.dataItems, w.queryInfo.where, &params)
+	sql, err := getUpdateSql(dao, dataItems, query.where, &params)
 	if err != nil {
 		return
 	}
@@ -294,14 +488,24 @@ func updateByWrapper(
 	return
 }
 
+// prepareQueryInfo 在查询条件中加入Dao级别的过滤条件：逻辑删除与多租户
+func prepareQueryInfo(ctx context.Context, dao *BaseDao, info queryInfo) (queryInfo, error) {
+	info = withLogicDelete(dao, info)
+	return withTenant(ctx, dao.GetTableName(), info)
+}
+
 // 生成Where语句
 // where 查询条件的数组 example:
 //
 //	where = []whereItem {
-//	    {"one", "in", []int{1, 2, 3}}, // ("in", "not in")
+//	    {"one", "in", []int{1, 2, 3}}, // ("in", "not in") 值也可以是子查询 *Wrapper 或 rawSql
 //	    {"two", "between", []interface{}{10, 20}}, // ("between", "not between")
 //	    {"three", ">", 10}, // ("=", "!=", "<", "<=", ">", ">=", "<>", "like")
 //	    {"four", "apply", []interface{}{"a = ? or b > ? and c > ?", 1, 2, 3}}, // ("apply")
+//	    {"five", "is null", nil}, // ("is null", "is not null")
+//	    {"", "exists", subWrapper}, // ("exists", "not exists") 子查询由 subWrapper 生成
+//	    {"", "or", nil}, // ("or") 下一个条件与前面的条件使用 or 连接，默认为 and
+//	    {"", "nested", []whereItem{...}}, // ("nested") 嵌套条件，生成的SQL会用括号包裹
 //	}
 func getWhereSql(
 	where []whereItem,
@@ -312,7 +516,9 @@ func getWhereSql(
 		return
 	}
 
-	whereList := make([]string, 0)
+	// 连接符默认为and，遇到or标记时，只对紧接着的下一个条件生效
+	// 位于开头、结尾或连续出现的or标记会被忽略
+	connector := "and"
 	for _, item := range where {
 		field := keyFormat(item.field)
 		value := item.value
@@ -330,18 +536,26 @@ func getWhereSql(
 
 		var current string
 		if item.op == "=" || item.op == "!=" || item.op == "<=" || item.op == "<" || item.op == ">=" ||
-			item.op == ">" || item.op == "<>" || item.op == "like" {
-			whereList = append(whereList, fmt.Sprintf("%s %s ?", field, item.op))
+			item.op == ">" || item.op == "<>" || item.op == "like" || item.op == "not like" {
+			current = fmt.Sprintf("%s %s ?", field, item.op)
 			*params = append(*params, item.value)
 		} else if item.op == "in" || item.op == "not in" {
 			current, err = getWhereInSql(field, item.op, item.value, params)
-			whereList = append(whereList, current)
 		} else if item.op == "between" || item.op == "not between" {
 			current, err = getWhereBetweenSql(field, item.op, item.value, params)
-			whereList = append(whereList, current)
 		} else if item.op == "apply" {
 			current, err = getWhereApplySql(field, item.value, params)
-			whereList = append(whereList, current)
+		} else if item.op == "is null" || item.op == "is not null" {
+			current = fmt.Sprintf("%s %s", field, item.op)
+		} else if item.op == "exists" || item.op == "not exists" {
+			current, err = getWhereExistsSql(item.op, item.value, params)
+		} else if item.op == "nested" {
+			current, err = getWhereNestedSql(item.value, params)
+		} else if item.op == "keyset" {
+			current, err = getWhereKeysetSql(item.value, params)
+		} else if item.op == "or" {
+			connector = "or"
+			continue
 		} else {
 			err = fmt.Errorf("db operate %s is not support, [field:%s]", item.op, field)
 		}
@@ -349,9 +563,36 @@ func getWhereSql(
 		if err != nil {
 			return
 		}
+
+		// 嵌套条件为空时，不生成任何SQL，对应的or标记也一并忽略
+		if current == "" {
+			connector = "and"
+			continue
+		}
+		if result == "" {
+			result = current
+		} else {
+			result += fmt.Sprintf(" %s %s", connector, current)
+		}
+		connector = "and"
 	}
 
-	result = strings.Join(whereList, fmt.Sprintf(" %s ", "and"))
+	return
+}
+
+// 生成嵌套的where语句
+func getWhereNestedSql(value interface{}, params *[]interface{}) (result string, err error) {
+	where, ok := value.([]whereItem)
+	if !ok {
+		err = fmt.Errorf("where nested format error: %T", value)
+		return
+	}
+
+	result, err = getWhereSql(where, params)
+	if err != nil || result == "" {
+		return
+	}
+	result = fmt.Sprintf("(%s)", result)
 	return
 }
 
@@ -378,6 +619,31 @@ func getWhereBetweenSql(key string, op string, value interface{}, params *[]inte
 
 // 生成in的where语句
 func getWhereInSql(key string, op string, value interface{}, params *[]interface{}) (result string, err error) {
+	// 子查询，参数按出现的顺序追加到params中
+	if sub, ok := value.(*Wrapper); ok {
+		// MySQL不支持在in子查询中使用limit（Error 1235）
+		if sub != nil && sub.queryInfo.limit > 0 {
+			err = fmt.Errorf("[%s] %s sub query does not support limit", key, op)
+			return
+		}
+		var subSql string
+		subSql, err = getSubSelectSql(sub, params)
+		if err != nil {
+			return
+		}
+		result = fmt.Sprintf("%s %s (%s)", key, op, subSql)
+		return
+	}
+	if raw, ok := value.(rawSql); ok {
+		if raw.sql == "" {
+			err = fmt.Errorf("[%s] where in sql is not allow empty", key)
+			return
+		}
+		result = fmt.Sprintf("%s %s (%s)", key, op, raw.sql)
+		*params = append(*params, raw.args...)
+		return
+	}
+
 	if reflect.ValueOf(value).Kind() != reflect.Slice {
 		err = fmt.Errorf("[%s] where in is not an array", key)
 		return
@@ -401,7 +667,23 @@ func getWhereInSql(key string, op string, value interface{}, params *[]interface
 	return
 }
 
-// 生成between的where语句
+// 生成exists的where语句
+func getWhereExistsSql(op string, value interface{}, params *[]interface{}) (result string, err error) {
+	sub, ok := value.(*Wrapper)
+	if !ok {
+		err = fmt.Errorf("where %s format error: %T", op, value)
+		return
+	}
+
+	subSql, err := getSubSelectSql(sub, params)
+	if err != nil {
+		return
+	}
+	result = fmt.Sprintf("%s (%s)", op, subSql)
+	return
+}
+
+// 生成apply的where语句
 func getWhereApplySql(key string, value interface{}, params *[]interface{}) (result string, err error) {
 	if reflect.ValueOf(value).Kind() != reflect.Slice {
 		err = fmt.Errorf("[%s] where params format error", key)
@@ -490,21 +772,47 @@ func getUpdateSql(
 
 // 生成select sql
 func getSelectSql(tableName string, info queryInfo) (result string, params []interface{}, err error) {
-	if info.tableName != "" {
-		tableName = info.tableName
+	return buildSelectSql(tableName, info, 1024)
+}
+
+// 生成子查询的select sql，表名取自子查询的Wrapper，子查询的绑定参数会按顺序追加到params中
+// 注意：子查询没有设置Limit时不会生成limit语句，in子查询设置了Limit时返回错误（MySQL不支持在in子查询中使用limit）
+func getSubSelectSql(sub *Wrapper, params *[]interface{}) (result string, err error) {
+	if sub == nil {
+		err = fmt.Errorf("sub query wrapper is nil")
+		return
 	}
-	if tableName == "" {
-		err = fmt.Errorf("table name is empty")
+
+	err = sub.GetError()
+	if err != nil {
+		return
+	}
+
+	result, subParams, err := buildSelectSql("", sub.queryInfo, 0)
+	if err != nil {
+		return
+	}
+	*params = append(*params, subParams...)
+	return
+}
+
+// buildSelectSql 生成select sql，defaultLimit为没有设置limit时使用的默认值，为0时不生成limit语句
+func buildSelectSql(tableName string, info queryInfo, defaultLimit int64) (result string, params []interface{}, err error) {
+	info, err = applyKeyset(info)
+	if err != nil {
 		return
 	}
+
 	selectPart := "*"
-	var wherePart, havingPart, groupPart, orderPart, limitPart, joinPart, asPart string
+	var fromPart, wherePart, havingPart, groupPart, orderPart, limitPart, joinPart string
 
 	if len(info.selectField) != 0 {
 		selectPart = strings.Join(info.selectField, ",")
 	}
-	if info.as != "" {
-		asPart = " " + info.as
+	// from 中的子查询参数位于where参数之前，所以要先生成
+	fromPart, err = getFromSql(tableName, info, &info.whereParams)
+	if err != nil {
+		return
 	}
 	if info.join != "" {
 		joinPart = " " + info.join
@@ -514,10 +822,12 @@ func getSelectSql(tableName string, info queryInfo) (result string, params []int
 		if err != nil {
 			return
 		}
-		wherePart = " where " + wherePart
+		if wherePart != "" {
+			wherePart = " where " + wherePart
+		}
 	}
 	if info.having != "" {
-		havingPart = " having " + havingPart
+		havingPart = " having " + info.having
 	}
 	if info.order != "" {
 		orderPart = " order by " + info.order
@@ -527,13 +837,15 @@ func getSelectSql(tableName string, info queryInfo) (result string, params []int
 	}
 
 	if info.limit == 0 {
-		info.limit = 1024
+		info.limit = defaultLimit
 	}
 	start := info.offset
 	if info.page > 1 {
 		start = (info.page - 1) * info.limit
 	}
-	if start == 0 {
+	if info.limit == 0 {
+		limitPart = ""
+	} else if start == 0 {
 		limitPart = fmt.Sprintf(" limit %d", info.limit)
 	} else {
 		limitPart = fmt.Sprintf(" limit %d, %d", start, info.limit)
@@ -541,10 +853,9 @@ func getSelectSql(tableName string, info queryInfo) (result string, params []int
 
 	params = info.whereParams
 	result = fmt.Sprintf(
-		"select %s from %s%s%s%s%s%s%s%s",
+		"select %s from %s%s%s%s%s%s%s",
 		selectPart,
-		tableName,
-		asPart,
+		fromPart,
 		joinPart,
 		wherePart,
 		groupPart,
@@ -556,24 +867,81 @@ func getSelectSql(tableName string, info queryInfo) (result string, params []int
 	return
 }
 
+// 生成from语句，优先级：派生表子查询 > Wrapper指定的表名 > 传入的表名
+func getFromSql(tableName string, info queryInfo, params *[]interface{}) (result string, err error) {
+	if info.fromSub != nil {
+		// MySQL要求派生表必须有别名
+		if info.as == "" {
+			err = fmt.Errorf("derived table must have an alias")
+			return
+		}
+		result, err = getSubSelectSql(info.fromSub, params)
+		if err != nil {
+			return
+		}
+		result = fmt.Sprintf("(%s) as %s", result, info.as)
+		return
+	}
+
+	if info.tableName != "" {
+		tableName = info.tableName
+	}
+	if tableName == "" {
+		err = fmt.Errorf("table name is empty")
+		return
+	}
+	result = tableName
+	if info.as != "" {
+		result += " " + info.as
+	}
+	return
+}
+
+// 生成count sql，去掉order by与limit
+// 有group by或having时，count的是分组后的条数，所以要将原查询作为子查询
+func getCountSql(tableName string, info queryInfo) (result string, params []interface{}, err error) {
+	info.keyset = nil
+	info.order = ""
+	info.limit = 0
+	info.page = 0
+	info.offset = 0
+
+	if info.group == "" && info.having == "" {
+		info.selectField = []string{"count(1) as cn"}
+		return buildSelectSql(tableName, info, 0)
+	}
+
+	result, params, err = buildSelectSql(tableName, info, 0)
+	if err != nil {
+		return
+	}
+	result = fmt.Sprintf("select count(1) as cn from (%s) as sqlbp_count", result)
+	return
+}
+
 // 生成select sql（单条）
 func getSelectOneSql(
 	dao *BaseDao,
 	info queryInfo,
 ) (result string, params []interface{}, err error) {
-	tableName := dao.GetTableName()
-	var wherePart, orderPart, joinPart, selectPart string
+	var fromPart, wherePart, orderPart, joinPart, selectPart string
 
 	selectPart = "*"
 	if len(info.selectField) != 0 {
 		selectPart = strings.Join(info.selectField, ",")
 	}
+	fromPart, err = getFromSql(dao.GetTableName(), info, &info.whereParams)
+	if err != nil {
+		return
+	}
 	if len(info.where) != 0 {
 		wherePart, err = getWhereSql(info.where, &info.whereParams)
 		if err != nil {
 			return
 		}
-		wherePart = " where " + wherePart
+		if wherePart != "" {
+			wherePart = " where " + wherePart
+		}
 	}
 	if len(info.order) != 0 {
 		orderPart = " order by " + info.order
@@ -586,7 +954,7 @@ func getSelectOneSql(
 	result = fmt.Sprintf(
 		"select %s from %s%s%s%s limit 0, 1",
 		selectPart,
-		tableName,
+		fromPart,
 		joinPart,
 		wherePart,
 		orderPart,
@@ -631,9 +999,13 @@ func getConnectByWrapper(
 	conn connectInter,
 	err error,
 ) {
-	tx := GetCtxTransaction(ctx)
+	tx := GetCtxTransactionByDb(ctx, dao.GetDbName())
 	if tx != nil {
-		conn = tx
+		conn = newInterceptConn(tx, dao, w, dao.GetDbName())
+		return
+	}
+	if txMismatchPolicy == TxMismatchError && GetCtxTransaction(ctx) != nil {
+		err = fmt.Errorf("%w, db: %s", ErrTxMismatch, dao.GetDbName())
 		return
 	}
 
@@ -644,9 +1016,10 @@ func getConnectByWrapper(
 		name = dao.GetSlaveDbName()
 	}
 
-	conn, err = getDbConnect(name)
+	db, err := getDbConnect(name)
 	if err != nil {
 		return
 	}
+	conn = newInterceptConn(db, dao, w, name)
 	return
 }
@@ -0,0 +1,36 @@
+package sqlbp
+
+// Page 分页查询的结果
+type Page struct {
+	Records interface{} `json:"records"` // 当前页的记录，即传入的dest
+	Total   int64       `json:"total"`   // 总条数，跳过count时为0
+	Pages   int64       `json:"pages"`   // 总页数，跳过count时为0
+	Current int64       `json:"current"` // 当前页码，从1开始
+	Size    int64       `json:"size"`    // 每页条数
+}
+
+// TypedPage 泛型Dao分页查询的结果
+type TypedPage[T any] struct {
+	Records []T   `json:"records"`
+	Total   int64 `json:"total"`
+	Pages   int64 `json:"pages"`
+	Current int64 `json:"current"`
+	Size    int64 `json:"size"`
+}
+
+// newPage 根据查询条件初始化分页信息，页码与条数的默认值与getSelectSql保持一致
+func newPage(dest interface{}, info queryInfo) Page {
+	page := Page{Records: dest, Current: info.page, Size: info.limit}
+	if page.Current < 1 {
+		page.Current = 1
+	}
+	if page.Size <= 0 {
+		page.Size = 1024
+	}
+	return page
+}
+
+func (p *Page) setTotal(total int64) {
+	p.Total = total
+	p.Pages = (total + p.Size - 1) / p.Size
+}
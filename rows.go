@@ -0,0 +1,79 @@
+package sqlbp
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+)
+
+// Rows 强类型的结果集游标，用于流式读取大量数据，内存占用与结果集大小无关
+// 使用完毕后必须调用Close释放连接
+//
+//	rows, err := sqlbp.QueryRows[DevStudentEntity](ctx, &GDevStudentDao.BaseDao, w)
+//	defer rows.Close()
+//	for rows.Next() {
+//	    item, err := rows.Scan()
+//	}
+//	err = rows.Err()
+type Rows[T any] struct {
+	ctx  context.Context
+	rows *sqlx.Rows
+	err  error
+}
+
+// QueryRows 执行查询并返回结果集游标，没有设置Limit时读取全部数据
+func QueryRows[T any](ctx context.Context, dao *BaseDao, w *Wrapper) (*Rows[T], error) {
+	err := dao.CheckDao()
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		w = GetWrapper()
+	}
+
+	err = w.GetError()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queryRowsByWrapper(ctx, dao, w)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows[T]{ctx: ctx, rows: rows}, nil
+}
+
+// Next 移动到下一行，没有更多数据、出错或ctx被取消时返回false
+func (r *Rows[T]) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	r.err = r.ctx.Err()
+	if r.err != nil {
+		return false
+	}
+	return r.rows.Next()
+}
+
+// Scan 读取当前行
+func (r *Rows[T]) Scan() (*T, error) {
+	var data T
+	err := r.rows.StructScan(&data)
+	if err != nil {
+		r.err = err
+		return nil, err
+	}
+	return &data, nil
+}
+
+// Err 返回遍历过程中遇到的错误
+func (r *Rows[T]) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return translateDriverError(r.rows.Err())
+}
+
+// Close 关闭结果集，可以重复调用
+func (r *Rows[T]) Close() error {
+	return r.rows.Close()
+}
@@ -0,0 +1,75 @@
+package sqlbp
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"testing"
+)
+
+type devStudentRow struct {
+	Id      int64  `db:"id"`
+	Name    string `db:"name"`
+	Age     int    `db:"age"`
+	ClassId int64  `db:"class_id"`
+}
+
+func TestIterate(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return studentRows(5)
+	}, DbMaster, DbSlave)
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName(TableDevStudent)
+
+	// 读取全部数据，不会添加默认的limit
+	var ids []int64
+	err := dao.Iterate(ctx, GetWrapper().Gt("age", 10), func(data *devStudentRow) error {
+		ids = append(ids, data.Id)
+		return nil
+	})
+	if err != nil || len(ids) != 5 {
+		t.Errorf("iterate got ids=%v, err=%v", ids, err)
+	}
+	if log := dbs[DbMaster].getLog(); len(log) != 1 || log[0] != "select * from dev_student where `age` > ?" {
+		t.Errorf("iterate sql got %v", log)
+	}
+
+	// fn返回错误时停止读取
+	stop := errors.New("stop")
+	count := 0
+	err = dao.BaseDao.IterateByWrapper(ctx, GetWrapper(), func(rows *sqlx.Rows) error {
+		var data devStudentRow
+		if err := rows.StructScan(&data); err != nil {
+			return err
+		}
+		count++
+		if data.Id == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || count != 2 {
+		t.Errorf("iterate stop got count=%d, err=%v", count, err)
+	}
+
+	// ctx被取消时停止读取
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rows, err := QueryRows[devStudentRow](cancelCtx, &dao.BaseDao, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	count = 0
+	for rows.Next() {
+		if _, err := rows.Scan(); err != nil {
+			t.Fatal(err)
+		}
+		count++
+		cancel()
+	}
+	if count != 1 || !errors.Is(rows.Err(), context.Canceled) {
+		t.Errorf("rows cancel got count=%d, err=%v", count, rows.Err())
+	}
+}
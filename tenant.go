@@ -0,0 +1,248 @@
+package sqlbp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+/*
+* 多租户隔离，参考Mybatis Plus的TenantLineInnerInterceptor
+* 开启后，查询、更新与删除会自动加上 `tenant_id` = 当前租户 的条件（包括Exists、InSub与派生表中的子查询），
+* 插入时会自动设置租户字段，更新时不允许修改租户字段
+* 当前租户通过 WithTenant 设置在context中，没有设置时会返回 ErrTenantMissing，避免误操作其它租户的数据
+* 注意：Join、Apply与InSql中的原生SQL无法自动加上租户条件，需要自行处理
+* 注意：Upsert（on duplicate key update）与Replace作用于唯一键冲突的已有记录，会自动设置租户字段，并且不会更新租户字段，
+* 但是唯一键必须包含租户字段（example: unique key (tenant_id, code)），否则冲突的记录可能属于其它租户
+ */
+
+// TenantLine 多租户的设置
+type TenantLine struct {
+	// 租户字段名，默认为 tenant_id
+	Column string
+
+	// 不需要租户隔离的表，example: 字典表、全局配置表
+	IgnoreTables []string
+}
+
+var tenantLine *TenantLine
+
+// SetTenantLine 开启多租户隔离，config为nil时关闭
+func SetTenantLine(config *TenantLine) {
+	tenantLine = config
+}
+
+func (t *TenantLine) column() string {
+	if t.Column == "" {
+		return "tenant_id"
+	}
+	return t.Column
+}
+
+// isIgnore 表是否不需要租户隔离，表名可以带有库名或者反引号
+func (t *TenantLine) isIgnore(table string) bool {
+	table = strings.ReplaceAll(table, "`", "")
+	for _, ignore := range t.IgnoreTables {
+		if ignore == table || ignore == getFieldName(table) {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKeyTenant struct{}
+
+type ctxKeySkipTenant struct{}
+
+// WithTenant 在context中设置当前租户
+func WithTenant(ctx context.Context, tenantId interface{}) context.Context {
+	return context.WithValue(ctx, ctxKeyTenant{}, tenantId)
+}
+
+// GetTenant 获取context中的当前租户，没有设置时返回nil
+func GetTenant(ctx context.Context) interface{} {
+	return ctx.Value(ctxKeyTenant{})
+}
+
+// SkipTenant 跳过多租户隔离，用于需要操作所有租户数据的管理任务
+func SkipTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeySkipTenant{}, true)
+}
+
+// getTenant 获取table需要的租户条件，不需要租户隔离时column为空
+func getTenant(ctx context.Context, table string) (column string, tenantId interface{}, err error) {
+	config := tenantLine
+	if config == nil || ctx.Value(ctxKeySkipTenant{}) != nil || config.isIgnore(table) {
+		return
+	}
+
+	tenantId = GetTenant(ctx)
+	if tenantId == nil {
+		err = fmt.Errorf("%w, table: %s", ErrTenantMissing, table)
+		return
+	}
+	column = config.column()
+	return
+}
+
+// withTenant 在查询条件中加入租户条件，包括where与from中的子查询，不会修改传入的数据
+func withTenant(ctx context.Context, table string, info queryInfo) (queryInfo, error) {
+	if tenantLine == nil {
+		return info, nil
+	}
+
+	var err error
+	var column string
+	var tenantId interface{}
+	if info.fromSub != nil {
+		// 派生表的子查询中已经有租户条件了
+		info.fromSub, err = withTenantWrapper(ctx, info.fromSub)
+		if err != nil {
+			return info, err
+		}
+	} else {
+		if info.tableName != "" {
+			table = info.tableName
+		}
+		column, tenantId, err = getTenant(ctx, table)
+		if err != nil {
+			return info, err
+		}
+	}
+
+	info.where, err = withTenantWhere(ctx, info.where)
+	if err != nil {
+		return info, err
+	}
+	if column != "" {
+		if info.as != "" {
+			column = info.as + "." + column
+		}
+		info.where = andWhere(info.where, createWhereItem(column, "=", tenantId))
+	}
+	return info, nil
+}
+
+// withTenantWhere 为where中的子查询加入租户条件
+func withTenantWhere(ctx context.Context, where []whereItem) ([]whereItem, error) {
+	result := make([]whereItem, len(where))
+	for i, item := range where {
+		switch value := item.value.(type) {
+		case *Wrapper:
+			sub, err := withTenantWrapper(ctx, value)
+			if err != nil {
+				return nil, err
+			}
+			item.value = sub
+		case []whereItem:
+			nested, err := withTenantWhere(ctx, value)
+			if err != nil {
+				return nil, err
+			}
+			item.value = nested
+		}
+		result[i] = item
+	}
+	return result, nil
+}
+
+// withTenantWrapper 复制子查询的Wrapper，并加入租户条件
+func withTenantWrapper(ctx context.Context, w *Wrapper) (*Wrapper, error) {
+	if w == nil {
+		return nil, nil
+	}
+	sub := *w
+	info, err := withTenant(ctx, "", w.queryInfo)
+	if err != nil {
+		return nil, err
+	}
+	sub.queryInfo = info
+	return &sub, nil
+}
+
+// withTenantInsert 插入数据时设置租户字段，数据中的租户与当前租户不一致时返回错误
+func withTenantInsert(ctx context.Context, dao *BaseDao, dataItems []dataItem) ([]dataItem, error) {
+	column, tenantId, err := getTenant(ctx, dao.GetTableName())
+	if err != nil || column == "" {
+		return dataItems, err
+	}
+
+	result := make([]dataItem, 0, len(dataItems)+1)
+	exist := false
+	for _, item := range dataItems {
+		if item.field == column {
+			exist = true
+			value, err := checkTenantValue(column, item.value, tenantId)
+			if err != nil {
+				return nil, err
+			}
+			item = dataItem{field: column, op: "value", value: value}
+		}
+		result = append(result, item)
+	}
+	if !exist {
+		result = append(result, dataItem{field: column, op: "value", value: tenantId})
+	}
+	return result, nil
+}
+
+// withTenantRows 批量插入时设置每一行的租户字段
+func withTenantRows(ctx context.Context, dao *BaseDao, data batchRows) (batchRows, error) {
+	column, tenantId, err := getTenant(ctx, dao.GetTableName())
+	if err != nil || column == "" {
+		return data, err
+	}
+
+	index := -1
+	for i, c := range data.columns {
+		if c == column {
+			index = i
+			break
+		}
+	}
+
+	result := batchRows{columns: data.columns, rows: make([][]interface{}, len(data.rows))}
+	if index == -1 {
+		result.columns = append(append(make([]string, 0, len(data.columns)+1), data.columns...), column)
+	}
+	for i, row := range data.rows {
+		if index == -1 {
+			result.rows[i] = append(append(make([]interface{}, 0, len(row)+1), row...), tenantId)
+			continue
+		}
+		value, err := checkTenantValue(column, row[index], tenantId)
+		if err != nil {
+			return data, err
+		}
+		result.rows[i] = append(make([]interface{}, 0, len(row)), row...)
+		result.rows[i][index] = value
+	}
+	return result, nil
+}
+
+// checkTenantValue 数据中的租户字段为空时使用当前租户，不一致时返回错误
+func checkTenantValue(column string, value interface{}, tenantId interface{}) (interface{}, error) {
+	if isZeroValue(value) {
+		return tenantId, nil
+	}
+	if fmt.Sprint(value) != fmt.Sprint(tenantId) {
+		return nil, fmt.Errorf("%s(%v) is not match current tenant(%v)", column, value, tenantId)
+	}
+	return value, nil
+}
+
+// withoutTenantData 去掉更新数据中的租户字段，不允许通过更新将数据转移到其它租户
+func withoutTenantData(ctx context.Context, dao *BaseDao, dataItems []dataItem) ([]dataItem, error) {
+	column, _, err := getTenant(ctx, dao.GetTableName())
+	if err != nil || column == "" {
+		return dataItems, err
+	}
+
+	result := make([]dataItem, 0, len(dataItems))
+	for _, item := range dataItems {
+		if item.field != column {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package sqlbp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type devProjectEntity struct {
+	Id       int64  `db:"id"`
+	Name     string `db:"name"`
+	TenantId int64  `db:"tenant_id"`
+}
+
+func TestTenantLine(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		if isSelect(query) {
+			return fakeResult{columns: []string{"cn"}, rows: studentRows(1).rows[:1:1]}
+		}
+		return fakeResult{affected: 1}
+	}, DbMaster)
+	SetTenantLine(&TenantLine{IgnoreTables: []string{"dev_dict"}})
+	t.Cleanup(func() { SetTenantLine(nil) })
+
+	ctx := WithTenant(context.Background(), int64(7))
+	dao := MustNewDao[devProjectEntity](DbMaster)
+	sub := GetWrapper().Select("project_id").TableName("dev_member").Eq("uid", 1)
+
+	_, _ = dao.Count(ctx, GetWrapper().Eq("name", "a").Or().InSub("id", sub))
+	_, _ = dao.Count(ctx, GetWrapper().TableName("dev_dict").Eq("id", 1))
+	_, _ = dao.UpdateByWrapper(ctx, GetWrapper().Set("name", "b").Set("tenant_id", 8).Eq("id", 1))
+	_, _ = dao.DeleteById(ctx, 1)
+	_, _ = dao.Insert(ctx, &devProjectEntity{Name: "c"})
+	_, _ = dao.BaseDao.InsertBatch(ctx, []map[string]interface{}{{"name": "d"}, {"name": "e"}}, nil)
+	_, _ = dao.Count(SkipTenant(ctx), GetWrapper().Eq("id", 1))
+
+	want := []string{
+		"select count(1) as cn from dev_project where (`name` = ? or `id` in (select project_id from dev_member where `uid` = ? and `tenant_id` = ?)) and `tenant_id` = ?",
+		"select count(1) as cn from dev_dict where `id` = ?",
+		"update dev_project set `name` = ? where `id` = ? and `tenant_id` = ?",
+		"delete from dev_project where `id` = ? and `tenant_id` = ?",
+		"insert into `dev_project`(`id`, `name`, `tenant_id`) values (?, ?, ?)",
+		"insert into `dev_project`(`name`, `tenant_id`) values (?, ?), (?, ?)",
+		"select count(1) as cn from dev_project where `id` = ?",
+	}
+	log := dbs[DbMaster].getLog()
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("tenant sql\n got: %q\nwant: %q", log, want)
+	}
+	if args := dbs[DbMaster].args[4]; args[2] != int64(7) {
+		t.Errorf("insert tenant args got %v", args)
+	}
+	// 调用方的子查询不会被修改
+	if len(sub.queryInfo.where) != 1 {
+		t.Errorf("sub wrapper should not be modified, got %v", sub.queryInfo.where)
+	}
+
+	if _, err := dao.Count(context.Background(), GetWrapper()); !errors.Is(err, ErrTenantMissing) {
+		t.Errorf("missing tenant should return ErrTenantMissing, got %v", err)
+	}
+	if _, err := dao.Insert(ctx, &devProjectEntity{Name: "f", TenantId: 8}); err == nil {
+		t.Error("insert other tenant should return error")
+	}
+
+	// Upsert与Replace自动设置租户字段，冲突时不更新租户字段
+	_, _ = dao.Upsert(ctx, &devProjectEntity{Name: "g"})
+	_, _ = dao.Replace(ctx, &devProjectEntity{Name: "h"})
+	log = dbs[DbMaster].getLog()
+	want = []string{
+		"insert into `dev_project`(`id`, `name`, `tenant_id`) values (?, ?, ?) on duplicate key update `name` = values(`name`)",
+		"replace into `dev_project`(`id`, `name`, `tenant_id`) values (?, ?, ?)",
+	}
+	if !reflect.DeepEqual(log[len(log)-2:], want) {
+		t.Errorf("tenant upsert sql\n got: %q\nwant: %q", log[len(log)-2:], want)
+	}
+	if args := dbs[DbMaster].args[len(log)-1]; args[2] != int64(7) {
+		t.Errorf("replace tenant args got %v", args)
+	}
+}
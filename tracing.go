@@ -0,0 +1,104 @@
+package sqlbp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+* OpenTelemetry链路追踪，每个Dao方法生成一个span，父span为ctx中的span
+* 方法中执行的每一条SQL生成一个子span（分页查询、批量操作等会执行多条SQL），db.statement 记录在SQL的span中
+* 通过 BeginTx 开启的事务会生成一个事务的span，SetCtxTransaction 之后事务中的SQL都是它的子span
+* Transaction、BeginContext 等函数开启的事务同样会生成事务的span
+ */
+
+const tracerName = "github.com/go-batis-plus"
+
+var tracer trace.Tracer
+
+// SetTracerProvider 开启链路追踪，provider为nil时关闭
+func SetTracerProvider(provider trace.TracerProvider) {
+	if provider == nil {
+		tracer = nil
+		return
+	}
+	tracer = provider.Tracer(tracerName)
+}
+
+// traceInterceptor 生成span的拦截器，在所有拦截器之前执行
+type traceInterceptor struct {
+	tracer trace.Tracer
+}
+
+func (t traceInterceptor) Before(ctx context.Context, stmt *Statement) (context.Context, error) {
+	ctx, _ = t.tracer.Start(ctx, stmt.Kind+" "+stmt.Table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mysql"),
+			attribute.String("db.name", stmt.DbName),
+			attribute.String("db.sql.table", stmt.Table),
+			attribute.String("db.operation", stmt.Kind),
+		),
+	)
+	return ctx, nil
+}
+
+func (t traceInterceptor) After(ctx context.Context, stmt *Statement) {
+	span := trace.SpanFromContext(ctx)
+	// 记录拦截器修改之后的SQL
+	span.SetAttributes(
+		attribute.String("db.statement", stmt.Sql),
+		attribute.Int64("db.rows_affected", stmt.RowsAffected),
+	)
+	endSpan(span, stmt.Err)
+}
+
+type ctxKeyDaoSpan struct{}
+
+// startDaoSpan 开始Dao方法的span，没有开启链路追踪，或者在其它Dao方法中调用（例如Upsert调用UpsertBatch）时返回nil
+func startDaoSpan(ctx context.Context, dao *BaseDao, method string, dbName string) (context.Context, trace.Span) {
+	t := tracer
+	if t == nil || ctx.Value(ctxKeyDaoSpan{}) != nil {
+		return ctx, nil
+	}
+	ctx, span := t.Start(ctx, method+" "+dao.GetTableName(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mysql"),
+			attribute.String("db.name", dbName),
+			attribute.String("db.sql.table", dao.GetTableName()),
+			attribute.String("db.operation", method),
+		),
+	)
+	return context.WithValue(ctx, ctxKeyDaoSpan{}, true), span
+}
+
+// endSpan 结束span，span为nil时忽略，查询不到数据不算错误
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startTxSpan 开启事务的span
+func startTxSpan(ctx context.Context, dbName string) (context.Context, trace.Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	return tracer.Start(ctx, "transaction",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mysql"),
+			attribute.String("db.name", dbName),
+		),
+	)
+}
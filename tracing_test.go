@@ -0,0 +1,86 @@
+package sqlbp
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"strings"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		if query == "delete from dev_student where `id` = ?" {
+			return fakeResult{err: errors.New("deadlock")}
+		}
+		if strings.HasPrefix(query, "select count(1)") {
+			return fakeResult{columns: []string{"cn"}, rows: [][]driver.Value{{int64(1)}}}
+		}
+		return fakeResult{affected: 1}
+	}, DbMaster)
+	recorder := tracetest.NewSpanRecorder()
+	SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { SetTracerProvider(nil) })
+
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName("dev_student")
+	ctx, parent := tracer.Start(context.Background(), "service")
+	_, _ = dao.UpdateByWrapper(ctx, GetWrapper().Set("name", "a").Eq("id", 1))
+	_, _ = dao.DeleteById(ctx, 1)
+
+	tx, err := BeginTx(ctx, DbMaster, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = dao.UpdateByWrapper(SetCtxTransaction(ctx, tx), GetWrapper().Set("name", "b").Eq("id", 2))
+	_ = Commit(tx)
+	// 分页查询执行两条SQL，都是同一个方法span的子span
+	_, _ = dao.SelectPage(ctx, GetWrapper().Page(1).Limit(10))
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 11 {
+		t.Fatalf("spans got %d", len(spans))
+	}
+	update, updateMethod, del, delMethod := spans[0], spans[1], spans[2], spans[3]
+	txUpdate, txMethod, txSpan := spans[4], spans[5], spans[6]
+	count, query, pageMethod := spans[7], spans[8], spans[9]
+	if updateMethod.Name() != "UpdateByWrapper dev_student" || updateMethod.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("method span got %s, parent %s", updateMethod.Name(), updateMethod.Parent().SpanID())
+	}
+	if update.Name() != "update dev_student" || update.Parent().SpanID() != updateMethod.SpanContext().SpanID() {
+		t.Errorf("update span got %s, parent %s", update.Name(), update.Parent().SpanID())
+	}
+	attrs := attribute.NewSet(update.Attributes()...)
+	for key, want := range map[attribute.Key]string{
+		"db.system":    "mysql",
+		"db.name":      DbMaster,
+		"db.sql.table": "dev_student",
+		"db.operation": "update",
+		"db.statement": "update dev_student set `name` = ? where `id` = ?",
+	} {
+		if v, _ := attrs.Value(key); v.AsString() != want {
+			t.Errorf("attribute %s got %s, want %s", key, v.AsString(), want)
+		}
+	}
+	methodAttrs := attribute.NewSet(updateMethod.Attributes()...)
+	if v, _ := methodAttrs.Value("db.operation"); v.AsString() != "UpdateByWrapper" {
+		t.Errorf("method span operation got %s", v.AsString())
+	}
+	if del.Status().Code != codes.Error || len(del.Events()) != 1 || delMethod.Status().Code != codes.Error {
+		t.Errorf("delete span should record error, got %v", del.Status())
+	}
+	if txSpan.Name() != "transaction" || txMethod.Parent().SpanID() != txSpan.SpanContext().SpanID() ||
+		txUpdate.Parent().SpanID() != txMethod.SpanContext().SpanID() {
+		t.Errorf("transaction span should be parent, got %s", txMethod.Parent().SpanID())
+	}
+	if pageMethod.Name() != "SelectPage dev_student" ||
+		count.Parent().SpanID() != pageMethod.SpanContext().SpanID() ||
+		query.Parent().SpanID() != pageMethod.SpanContext().SpanID() {
+		t.Errorf("page statements should be children of the method span, got %s", pageMethod.Name())
+	}
+}
@@ -2,7 +2,13 @@ package sqlbp
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -10,38 +16,447 @@ const (
 	ctxKeyTransactionPoint = "gbp_transaction_point"
 )
 
+// txHooks 事务提交或回滚之后执行的回调
+type txHooks struct {
+	mu         sync.Mutex
+	onCommit   []func()
+	onRollback []func()
+}
+
+func (h *txHooks) add(commit bool, fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if commit {
+		h.onCommit = append(h.onCommit, fn)
+	} else {
+		h.onRollback = append(h.onRollback, fn)
+	}
+}
+
+// run 事务结束时按注册的顺序执行回调，每个回调只会执行一次
+func (h *txHooks) run(committed bool) {
+	h.mu.Lock()
+	hooks := h.onRollback
+	if committed {
+		hooks = h.onCommit
+	}
+	h.onCommit, h.onRollback = nil, nil
+	h.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// mark 记录当前的回调数量，用于回滚到保存点
+func (h *txHooks) mark() (commitLen int, rollbackLen int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.onCommit), len(h.onRollback)
+}
+
+// rollbackTo 回滚到保存点时，丢弃保存点之后注册的提交回调，并执行之后注册的回滚回调
+func (h *txHooks) rollbackTo(commitLen int, rollbackLen int) {
+	h.mu.Lock()
+	h.onCommit = h.onCommit[:commitLen]
+	hooks := append([]func(){}, h.onRollback[rollbackLen:]...)
+	h.onRollback = h.onRollback[:rollbackLen]
+	h.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// txState 事务的附加信息，保存在context中，随context一起释放
+// 通过 Begin/BeginTx 开启的事务同时保存在txStates中，在 Commit/Rollback 时删除
+type txState struct {
+	dbName       string     // 开启事务的连接名，不是通过BeginTx开启的事务为空
+	span         trace.Span // 事务的span，没有开启链路追踪或者不是通过BeginTx开启的事务时为nil
+	rollbackOnly bool       // 加入的事务执行失败，只能回滚
+	hooks        *txHooks
+}
+
+// txStates 通过 Begin/BeginTx 开启的事务的附加信息
+// 注意：通过 Begin/BeginTx 开启的事务需要通过 Commit/Rollback 或 CommitContext/RollbackContext 结束
+var txStates sync.Map // *sqlx.Tx => *txState
+
+func getTxState(tx *sqlx.Tx) *txState {
+	v, ok := txStates.Load(tx)
+	if !ok {
+		return nil
+	}
+	return v.(*txState)
+}
+
+// finish 提交或回滚事务，结束事务的span并执行回调
+func (s *txState) finish(tx *sqlx.Tx, commit bool) (err error) {
+	err = s.end(tx, commit)
+	s.hooks.run(commit && err == nil)
+	return
+}
+
+// end 提交或回滚事务，结束事务的span，不执行回调
+// 事务被标记为只能回滚时，提交会回滚事务并返回 ErrTxRollbackOnly
+func (s *txState) end(tx *sqlx.Tx, commit bool) (err error) {
+	txStates.Delete(tx)
+	switch {
+	case commit && s.rollbackOnly:
+		err = ErrTxRollbackOnly
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			err = errors.Join(err, rollbackErr)
+		}
+	case commit:
+		err = translateDriverError(tx.Commit())
+	default:
+		err = translateDriverError(tx.Rollback())
+	}
+	if s.span != nil {
+		endSpan(s.span, err)
+	}
+	return
+}
+
+// ctxTx context中的事务，每个连接名一个，通过parent查找外层设置的其它连接的事务
+type ctxTx struct {
+	dbName string // 连接名，为空时可以匹配所有连接
+	tx     *sqlx.Tx
+	state  *txState
+	parent *ctxTx
+}
+
+func (n *ctxTx) finish(commit bool) error {
+	return n.state.finish(n.tx, commit)
+}
+
+func (n *ctxTx) end(commit bool) error {
+	return n.state.end(n.tx, commit)
+}
+
 func Begin(dbName string) (tx *sqlx.Tx, err error) {
+	return BeginTx(context.Background(), dbName, nil)
+}
+
+// BeginTx 开启事务，opts可以设置隔离级别与只读，开启链路追踪时会生成事务的span
+// 注意：ctx被取消时事务会自动回滚
+func BeginTx(ctx context.Context, dbName string, opts *sql.TxOptions) (tx *sqlx.Tx, err error) {
 	var db *sqlx.DB
 	db, err = getDbConnect(dbName)
 	if err != nil {
 		return
 	}
-	tx, err = db.Beginx()
+
+	ctx, span := startTxSpan(ctx, dbName)
+	tx, err = db.BeginTxx(ctx, opts)
 	if err != nil {
+		err = translateDriverError(err)
+		if span != nil {
+			endSpan(span, err)
+		}
 		return
 	}
+	txStates.Store(tx, &txState{dbName: dbName, span: span, hooks: &txHooks{}})
 	return
 }
 
+// Rollback 回滚事务，结束事务的span，并执行OnRollback注册的回调
 func Rollback(tx *sqlx.Tx) error {
-	return tx.Rollback()
+	if state := getTxState(tx); state != nil {
+		return state.finish(tx, false)
+	}
+	return translateDriverError(tx.Rollback())
 }
 
+// Commit 提交事务，结束事务的span，成功时执行OnCommit注册的回调，失败时执行OnRollback注册的回调
+// 加入的事务执行失败时，事务被标记为只能回滚，此时会回滚事务并返回 ErrTxRollbackOnly
 func Commit(tx *sqlx.Tx) error {
-	return tx.Commit()
+	if state := getTxState(tx); state != nil {
+		return state.finish(tx, true)
+	}
+	return translateDriverError(tx.Commit())
+}
+
+// BeginContext 开启事务并设置在返回的context中，需要通过CommitContext或RollbackContext结束事务
+// 开启链路追踪时会生成事务的span，事务中的SQL都是它的子span
+func BeginContext(ctx context.Context, dbName string, opts *sql.TxOptions) (txCtx context.Context, err error) {
+	txCtx, _, err = beginCtxTransaction(ctx, dbName, opts)
+	return
+}
+
+// CommitContext 提交ctx中最后设置的事务，成功时执行OnCommit注册的回调，失败时执行OnRollback注册的回调
+// 事务被标记为只能回滚时，回滚事务并返回 ErrTxRollbackOnly
+func CommitContext(ctx context.Context) error {
+	node, _ := ctx.Value(ctxKeyTransactionPoint).(*ctxTx)
+	if node == nil {
+		return fmt.Errorf("no transaction in context")
+	}
+	return node.finish(true)
+}
+
+// RollbackContext 回滚ctx中最后设置的事务，并执行OnRollback注册的回调
+func RollbackContext(ctx context.Context) error {
+	node, _ := ctx.Value(ctxKeyTransactionPoint).(*ctxTx)
+	if node == nil {
+		return fmt.Errorf("no transaction in context")
+	}
+	return node.finish(false)
+}
+
+// beginCtxTransaction 开启事务并设置在context中
+func beginCtxTransaction(ctx context.Context, dbName string, opts *sql.TxOptions) (context.Context, *ctxTx, error) {
+	tx, err := BeginTx(ctx, dbName, opts)
+	if err != nil {
+		return ctx, nil, err
+	}
+	ctx = SetCtxTransactionByDb(ctx, dbName, tx)
+	return ctx, ctx.Value(ctxKeyTransactionPoint).(*ctxTx), nil
+}
+
+// OnCommit 注册ctx中的事务提交之后执行的回调，按注册的顺序执行，ctx中没有事务时立即执行
+// 通过Transaction等事务函数、Commit或者CommitContext提交时执行回调，嵌套事务回滚到保存点时会丢弃其中注册的回调
+// 注意：不是通过Begin开启、由SetCtxTransaction设置的事务，只有通过CommitContext提交时才会执行回调
+func OnCommit(ctx context.Context, fn func()) {
+	node, _ := ctx.Value(ctxKeyTransactionPoint).(*ctxTx)
+	if node == nil {
+		fn()
+		return
+	}
+	node.state.hooks.add(true, fn)
+}
+
+// OnRollback 注册ctx中的事务回滚之后执行的回调，按注册的顺序执行，ctx中没有事务时不会执行
+func OnRollback(ctx context.Context, fn func()) {
+	node, _ := ctx.Value(ctxKeyTransactionPoint).(*ctxTx)
+	if node == nil {
+		return
+	}
+	node.state.hooks.add(false, fn)
 }
 
-// SetCtxTransaction 在context中设置对应的事务
+// TxMismatchPolicy 事务与Dao的连接名不一致时的处理方式
+type TxMismatchPolicy int
+
+const (
+	// TxMismatchFallback 不使用事务，在Dao自己的连接上执行（默认）
+	TxMismatchFallback TxMismatchPolicy = iota
+
+	// TxMismatchError 返回 ErrTxMismatch
+	TxMismatchError
+)
+
+var txMismatchPolicy = TxMismatchFallback
+
+// SetTxMismatchPolicy 设置ctx中没有Dao所在连接的事务，但是有其它连接的事务时的处理方式
+func SetTxMismatchPolicy(policy TxMismatchPolicy) {
+	txMismatchPolicy = policy
+}
+
+// SetCtxTransaction 在context中设置对应的事务，连接名为开启事务时的连接名，事务有span时，之后执行的SQL都是它的子span
 // 注意：开启事务之后，SQL会在事务所在的dblink上执行，不会遵守dao的主从库设置
+// 不是通过Begin开启的事务没有连接名，会被所有Dao使用，多个连接时请使用SetCtxTransactionByDb
 func SetCtxTransaction(ctx context.Context, tx *sqlx.Tx) (childCtx context.Context) {
-	return context.WithValue(ctx, ctxKeyTransactionPoint, tx)
+	var dbName string
+	if state := getTxState(tx); state != nil {
+		dbName = state.dbName
+	}
+	return SetCtxTransactionByDb(ctx, dbName, tx)
 }
 
+// SetCtxTransactionByDb 在context中设置连接名对应的事务，不影响其它连接的事务
+func SetCtxTransactionByDb(ctx context.Context, dbName string, tx *sqlx.Tx) (childCtx context.Context) {
+	parent, _ := ctx.Value(ctxKeyTransactionPoint).(*ctxTx)
+	// 同一个事务共用附加信息
+	state := getTxState(tx)
+	for v := parent; state == nil && v != nil; v = v.parent {
+		if v.tx == tx {
+			state = v.state
+		}
+	}
+	if state == nil {
+		state = &txState{hooks: &txHooks{}}
+	}
+	if state.span != nil {
+		ctx = trace.ContextWithSpan(ctx, state.span)
+	}
+	return context.WithValue(ctx, ctxKeyTransactionPoint, &ctxTx{dbName: dbName, tx: tx, state: state, parent: parent})
+}
+
+// getCtxTx 获取context中连接名对应的事务
+func getCtxTx(ctx context.Context, dbName string) *ctxTx {
+	v, _ := ctx.Value(ctxKeyTransactionPoint).(*ctxTx)
+	for ; v != nil; v = v.parent {
+		if v.dbName == dbName || v.dbName == "" {
+			return v
+		}
+	}
+	return nil
+}
+
+// GetCtxTransaction 获取context中最后设置的事务
 func GetCtxTransaction(ctx context.Context) (tx *sqlx.Tx) {
-	v := ctx.Value(ctxKeyTransactionPoint)
-	tx, ok := v.(*sqlx.Tx)
+	v, ok := ctx.Value(ctxKeyTransactionPoint).(*ctxTx)
 	if ok {
-		return tx
+		return v.tx
+	}
+	return nil
+}
+
+// GetCtxTransactionByDb 获取context中连接名对应的事务
+func GetCtxTransactionByDb(ctx context.Context, dbName string) (tx *sqlx.Tx) {
+	if v := getCtxTx(ctx, dbName); v != nil {
+		return v.tx
 	}
 	return nil
 }
+
+// Propagation 事务的传播方式，参考Spring的事务传播
+type Propagation int
+
+const (
+	// PropagationRequired 加入ctx中该连接已有的事务，没有则开启新事务（默认）
+	// 加入已有事务时fn返回错误，外层事务会被标记为只能回滚，提交时返回 ErrTxRollbackOnly
+	PropagationRequired Propagation = iota
+
+	// PropagationRequiresNew 总是在新的连接上开启独立的事务，与外层事务互不影响
+	PropagationRequiresNew
+
+	// PropagationNested 有事务时通过 SAVEPOINT 开启嵌套事务，fn返回错误时只回滚到保存点，没有事务时同 PropagationRequired
+	PropagationNested
+
+	// PropagationSupports 有事务时加入事务，没有则不使用事务
+	PropagationSupports
+
+	// PropagationNever 不使用事务，ctx中有该连接的事务时返回 ErrTxExists
+	PropagationNever
+)
+
+var savepointSeq int64
+
+// Transaction 在事务中执行fn，fn返回nil时提交，返回错误或panic时回滚（panic会继续抛出）
+// fn中需要使用txCtx执行SQL，ctx中已有事务时加入该事务
+func Transaction(ctx context.Context, dbName string, fn func(txCtx context.Context) error) error {
+	return TransactionWithPropagation(ctx, dbName, PropagationRequired, nil, fn)
+}
+
+// TransactionWithOptions 同Transaction，opts可以设置隔离级别与只读，加入已有事务时opts无效
+func TransactionWithOptions(
+	ctx context.Context,
+	dbName string,
+	opts *sql.TxOptions,
+	fn func(txCtx context.Context) error,
+) error {
+	return TransactionWithPropagation(ctx, dbName, PropagationRequired, opts, fn)
+}
+
+// TransactionWithPropagation 按照propagation执行fn，opts只在开启新事务时有效
+func TransactionWithPropagation(
+	ctx context.Context,
+	dbName string,
+	propagation Propagation,
+	opts *sql.TxOptions,
+	fn func(txCtx context.Context) error,
+) error {
+	node := getCtxTx(ctx, dbName)
+	switch propagation {
+	case PropagationRequired:
+		if node != nil {
+			return joinTransaction(ctx, node, fn)
+		}
+	case PropagationRequiresNew:
+	case PropagationNested:
+		if node != nil {
+			return nestedTransaction(ctx, node, fn)
+		}
+	case PropagationSupports:
+		return fn(ctx)
+	case PropagationNever:
+		if node != nil {
+			return ErrTxExists
+		}
+		return fn(ctx)
+	default:
+		return fmt.Errorf("not support propagation(%d)", propagation)
+	}
+	return newTransaction(ctx, dbName, opts, fn)
+}
+
+// newTransaction 开启新事务执行fn
+func newTransaction(
+	ctx context.Context,
+	dbName string,
+	opts *sql.TxOptions,
+	fn func(txCtx context.Context) error,
+) (err error) {
+	txCtx, node, err := beginCtxTransaction(ctx, dbName, opts)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = node.finish(false)
+			panic(p)
+		}
+		if err == nil && node.state.rollbackOnly {
+			err = ErrTxRollbackOnly
+		}
+		if err != nil {
+			if rollbackErr := node.finish(false); rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+			return
+		}
+		err = node.finish(true)
+	}()
+
+	err = fn(txCtx)
+	return
+}
+
+// joinTransaction 加入已有事务执行fn，失败时将事务标记为只能回滚
+func joinTransaction(ctx context.Context, node *ctxTx, fn func(txCtx context.Context) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			node.state.rollbackOnly = true
+			panic(p)
+		}
+		if err != nil {
+			node.state.rollbackOnly = true
+		}
+	}()
+	return fn(ctx)
+}
+
+// nestedTransaction 通过保存点执行fn，失败时回滚到保存点，不影响外层事务
+func nestedTransaction(ctx context.Context, node *ctxTx, fn func(txCtx context.Context) error) (err error) {
+	tx := node.tx
+	savepoint := fmt.Sprintf("sqlbp_sp_%d", atomic.AddInt64(&savepointSeq, 1))
+	_, err = tx.ExecContext(ctx, "savepoint "+savepoint)
+	if err != nil {
+		err = translateDriverError(err)
+		return
+	}
+	commitLen, rollbackLen := node.state.hooks.mark()
+	// 回滚到保存点时，保存点之后加入的事务的失败也一起撤销，恢复只能回滚的标记
+	rollbackOnly := node.state.rollbackOnly
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = tx.ExecContext(ctx, "rollback to savepoint "+savepoint)
+			node.state.rollbackOnly = rollbackOnly
+			node.state.hooks.rollbackTo(commitLen, rollbackLen)
+			panic(p)
+		}
+		if err != nil {
+			if _, rollbackErr := tx.ExecContext(ctx, "rollback to savepoint "+savepoint); rollbackErr != nil {
+				err = errors.Join(err, translateDriverError(rollbackErr))
+			}
+			node.state.rollbackOnly = rollbackOnly
+			node.state.hooks.rollbackTo(commitLen, rollbackLen)
+			return
+		}
+		_, err = tx.ExecContext(ctx, "release savepoint "+savepoint)
+		err = translateDriverError(err)
+	}()
+
+	err = fn(ctx)
+	return
+}
@@ -0,0 +1,291 @@
+package sqlbp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return fakeResult{affected: 1}
+	}, DbMaster)
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName("dev_student")
+	update := func(txCtx context.Context) error {
+		_, err := dao.UpdateByWrapper(txCtx, GetWrapper().Set("name", "a").Eq("id", 1))
+		return err
+	}
+
+	err := Transaction(ctx, DbMaster, update)
+	if err != nil {
+		t.Errorf("transaction got %v", err)
+	}
+
+	errFailed := errors.New("failed")
+	err = TransactionWithOptions(ctx, DbMaster, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true},
+		func(txCtx context.Context) error {
+			_ = update(txCtx)
+			return errFailed
+		})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("transaction should return fn error, got %v", err)
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("panic should be re-panicked, got %v", p)
+			}
+		}()
+		_ = Transaction(ctx, DbMaster, func(txCtx context.Context) error {
+			_ = update(txCtx)
+			panic("boom")
+		})
+	}()
+
+	updateSql := "update dev_student set `name` = ? where `id` = ?"
+	want := []string{
+		"begin", updateSql, "commit",
+		"begin Serializable read only", updateSql, "rollback",
+		"begin", updateSql, "rollback",
+	}
+	if log := dbs[DbMaster].getLog(); !reflect.DeepEqual(log, want) {
+		t.Errorf("transaction sql\n got: %q\nwant: %q", log, want)
+	}
+}
+
+func TestTransactionPropagation(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return fakeResult{affected: 1}
+	}, DbMaster)
+	ctx := context.Background()
+	dao := MustNewDao[devStudentRow](DbMaster)
+	dao.SetTableName("dev_student")
+	update := func(txCtx context.Context) error {
+		_, err := dao.UpdateByWrapper(txCtx, GetWrapper().Set("name", "a").Eq("id", 1))
+		return err
+	}
+	errFailed := errors.New("failed")
+	savepointSeq = 0
+
+	// 嵌套事务失败只回滚到保存点，独立事务单独提交
+	err := Transaction(ctx, DbMaster, func(txCtx context.Context) error {
+		_ = TransactionWithPropagation(txCtx, DbMaster, PropagationNested, nil, func(txCtx context.Context) error {
+			_ = update(txCtx)
+			return errFailed
+		})
+		_ = TransactionWithPropagation(txCtx, DbMaster, PropagationNested, nil, update)
+		_ = TransactionWithPropagation(txCtx, DbMaster, PropagationRequiresNew, nil, update)
+		if err := TransactionWithPropagation(txCtx, DbMaster, PropagationNever, nil, update); !errors.Is(err, ErrTxExists) {
+			t.Errorf("propagation never should return ErrTxExists, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("transaction got %v", err)
+	}
+
+	// 加入的事务失败时，外层事务只能回滚
+	err = Transaction(ctx, DbMaster, func(txCtx context.Context) error {
+		_ = Transaction(txCtx, DbMaster, func(txCtx context.Context) error {
+			return errFailed
+		})
+		return nil
+	})
+	if !errors.Is(err, ErrTxRollbackOnly) {
+		t.Errorf("transaction should be rollback only, got %v", err)
+	}
+
+	// 嵌套事务中加入的事务失败，回滚到保存点后外层事务仍然可以提交
+	err = Transaction(ctx, DbMaster, func(txCtx context.Context) error {
+		_ = TransactionWithPropagation(txCtx, DbMaster, PropagationNested, nil, func(txCtx context.Context) error {
+			return Transaction(txCtx, DbMaster, func(txCtx context.Context) error {
+				return errFailed
+			})
+		})
+		return nil
+	})
+	if err != nil {
+		t.Errorf("nested rollback should clear rollback only, got %v", err)
+	}
+
+	// Commit与CommitContext同样遵守只能回滚的标记
+	tx, err := Begin(DbMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = Transaction(SetCtxTransaction(ctx, tx), DbMaster, func(txCtx context.Context) error {
+		return errFailed
+	})
+	if err = Commit(tx); !errors.Is(err, ErrTxRollbackOnly) {
+		t.Errorf("commit should be rollback only, got %v", err)
+	}
+	txCtx, err := BeginContext(ctx, DbMaster, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = Transaction(txCtx, DbMaster, func(txCtx context.Context) error {
+		return errFailed
+	})
+	if err = CommitContext(txCtx); !errors.Is(err, ErrTxRollbackOnly) {
+		t.Errorf("commit context should be rollback only, got %v", err)
+	}
+
+	_ = TransactionWithPropagation(ctx, DbMaster, PropagationSupports, nil, update)
+
+	updateSql := "update dev_student set `name` = ? where `id` = ?"
+	want := []string{
+		"begin",
+		"savepoint sqlbp_sp_1", updateSql, "rollback to savepoint sqlbp_sp_1",
+		"savepoint sqlbp_sp_2", updateSql, "release savepoint sqlbp_sp_2",
+		"begin", updateSql, "commit",
+		"commit",
+		"begin", "rollback",
+		"begin", "savepoint sqlbp_sp_3", "rollback to savepoint sqlbp_sp_3", "commit",
+		"begin", "rollback",
+		"begin", "rollback",
+		updateSql,
+	}
+	if log := dbs[DbMaster].getLog(); !reflect.DeepEqual(log, want) {
+		t.Errorf("propagation sql\n got: %q\nwant: %q", log, want)
+	}
+}
+
+func TestTransactionByDb(t *testing.T) {
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return fakeResult{affected: 1}
+	}, DbMaster, DbSlave)
+	t.Cleanup(func() { SetTxMismatchPolicy(TxMismatchFallback) })
+	ctx := context.Background()
+	masterDao := MustNewDao[devStudentRow](DbMaster)
+	masterDao.SetTableName("dev_student")
+	slaveDao := MustNewDao[devStudentRow](DbSlave)
+	slaveDao.SetTableName("dev_class")
+	readDao := MustNewDao[devStudentRow](DbMaster)
+	readDao.SetTableName("dev_student")
+	readDao.SetSlaveDbName(DbSlave)
+
+	_ = Transaction(ctx, DbMaster, func(txCtx context.Context) error {
+		// 事务中按ID查询使用事务的连接，而不是从库
+		_, _ = readDao.GetById(txCtx, 5)
+		// 另一个连接的Dao不会使用master的事务
+		_, _ = slaveDao.DeleteById(txCtx, 1)
+		_ = Transaction(txCtx, DbSlave, func(txCtx context.Context) error {
+			_, _ = masterDao.DeleteById(txCtx, 2)
+			_, _ = slaveDao.DeleteById(txCtx, 3)
+			if GetCtxTransactionByDb(txCtx, DbMaster) == GetCtxTransactionByDb(txCtx, DbSlave) {
+				t.Error("each db should have its own transaction")
+			}
+			return nil
+		})
+
+		SetTxMismatchPolicy(TxMismatchError)
+		if _, err := slaveDao.DeleteById(txCtx, 4); !errors.Is(err, ErrTxMismatch) {
+			t.Errorf("mismatch should return ErrTxMismatch, got %v", err)
+		}
+		if _, err := slaveDao.GetById(txCtx, 6); !errors.Is(err, ErrTxMismatch) {
+			t.Errorf("get by id mismatch should return ErrTxMismatch, got %v", err)
+		}
+		return nil
+	})
+
+	// Begin开启的事务记录了连接名，不会被其它连接的Dao使用
+	SetTxMismatchPolicy(TxMismatchFallback)
+	tx, err := Begin(DbMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txCtx := SetCtxTransaction(ctx, tx)
+	_, _ = slaveDao.DeleteById(txCtx, 7)
+	SetTxMismatchPolicy(TxMismatchError)
+	if _, err = slaveDao.DeleteById(txCtx, 8); !errors.Is(err, ErrTxMismatch) {
+		t.Errorf("mismatch of Begin should return ErrTxMismatch, got %v", err)
+	}
+	_, _ = masterDao.DeleteById(txCtx, 9)
+	_ = Commit(tx)
+
+	deleteStudent, deleteClass := "delete from dev_student where `id` = ?", "delete from dev_class where `id` = ?"
+	want := map[string][]string{
+		DbMaster: {"begin", "select * from dev_student where `id` = ? limit 0, 1", deleteStudent, "commit",
+			"begin", deleteStudent, "commit"},
+		DbSlave: {deleteClass, "begin", deleteClass, "commit", deleteClass},
+	}
+	for name, db := range dbs {
+		if log := db.getLog(); !reflect.DeepEqual(log, want[name]) {
+			t.Errorf("%s sql\n got: %q\nwant: %q", name, log, want[name])
+		}
+	}
+}
+
+func TestTransactionHooks(t *testing.T) {
+	useFakeDb(t, nil, DbMaster)
+	ctx := context.Background()
+	events := make([]string, 0)
+	record := func(event string) func() {
+		return func() { events = append(events, event) }
+	}
+
+	OnCommit(ctx, record("no tx"))
+	OnRollback(ctx, record("no tx rollback"))
+	_ = Transaction(ctx, DbMaster, func(txCtx context.Context) error {
+		OnCommit(txCtx, record("commit 1"))
+		OnRollback(txCtx, record("rollback 1"))
+		_ = TransactionWithPropagation(txCtx, DbMaster, PropagationNested, nil, func(txCtx context.Context) error {
+			OnCommit(txCtx, record("nested commit"))
+			OnRollback(txCtx, record("nested rollback"))
+			return errors.New("failed")
+		})
+		OnCommit(txCtx, record("commit 2"))
+		if len(events) != 2 {
+			t.Errorf("commit hooks should not run before commit, got %v", events)
+		}
+		return nil
+	})
+	_ = Transaction(ctx, DbMaster, func(txCtx context.Context) error {
+		OnCommit(txCtx, record("commit 3"))
+		OnRollback(txCtx, record("rollback 3"))
+		return errors.New("failed")
+	})
+
+	// 外部开启的事务，通过CommitContext提交时执行回调
+	tx, err := linkMap[DbMaster].Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txCtx := SetCtxTransaction(ctx, tx)
+	OnCommit(txCtx, record("commit 4"))
+	OnCommit(SetCtxTransaction(txCtx, tx), record("commit 5"))
+	if err = CommitContext(txCtx); err != nil {
+		t.Errorf("commit context got %v", err)
+	}
+
+	// Begin开启的事务，通过Commit或Rollback结束时执行回调
+	tx, err = Begin(DbMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txCtx = SetCtxTransaction(ctx, tx)
+	OnCommit(txCtx, record("commit 6"))
+	OnRollback(txCtx, record("rollback 6"))
+	if err = Commit(tx); err != nil {
+		t.Errorf("commit got %v", err)
+	}
+	tx, err = Begin(DbMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txCtx = SetCtxTransaction(ctx, tx)
+	OnCommit(txCtx, record("commit 7"))
+	OnRollback(txCtx, record("rollback 7"))
+	_ = Rollback(tx)
+
+	want := []string{"no tx", "nested rollback", "commit 1", "commit 2", "rollback 3", "commit 4", "commit 5",
+		"commit 6", "rollback 7"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("hook events\n got: %q\nwant: %q", events, want)
+	}
+}
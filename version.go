@@ -0,0 +1,78 @@
+package sqlbp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// versionField 实体中的乐观锁版本号字段
+type versionField struct {
+	column string
+	value  reflect.Value
+}
+
+// getVersionField 获取实体中带有 `sqlbp:"version"` 标签的字段，data不是结构体或者没有版本号字段时返回nil
+func getVersionField(data interface{}) (*versionField, error) {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	meta, err := getEntityMeta(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range meta.fields {
+		if _, ok := field.options["version"]; !ok {
+			continue
+		}
+
+		value := v.FieldByIndex(field.index)
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, fmt.Errorf("version field %s must be integer, not allow %s", field.column, value.Type())
+		}
+		return &versionField{column: field.column, value: value}, nil
+	}
+	return nil, nil
+}
+
+// updateWithVersion 使用乐观锁更新，没有更新到记录时返回 ErrOptimisticLock
+func updateWithVersion(
+	ctx context.Context,
+	dao *BaseDao,
+	w *Wrapper,
+	version *versionField,
+) (affectedRow int64, err error) {
+	dataItems := make([]dataItem, 0, len(w.dataItems))
+	for _, item := range w.dataItems {
+		if item.field != version.column {
+			dataItems = append(dataItems, item)
+		}
+	}
+	dataItems = append(dataItems, dataItem{field: version.column, op: "exp", value: keyFormat(version.column) + " + 1"})
+	w.dataItems = dataItems
+	w.queryInfo.where = append(w.queryInfo.where, createWhereItem(version.column, "=", version.value.Interface()))
+
+	affectedRow, err = updateByWrapper(ctx, dao, w)
+	if err != nil {
+		return
+	}
+	if affectedRow == 0 {
+		err = ErrOptimisticLock
+		return
+	}
+
+	// data为指针时，同步更新后的版本号
+	if version.value.CanSet() {
+		if version.value.CanInt() {
+			version.value.SetInt(version.value.Int() + 1)
+		} else {
+			version.value.SetUint(version.value.Uint() + 1)
+		}
+	}
+	return
+}
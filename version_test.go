@@ -0,0 +1,48 @@
+package sqlbp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type devAccountEntity struct {
+	Id      int64  `db:"id"`
+	Balance int64  `db:"balance"`
+	Version uint32 `db:"version" sqlbp:"version"`
+}
+
+func TestOptimisticLock(t *testing.T) {
+	var affected int64 = 1
+	dbs := useFakeDb(t, func(query string, args []interface{}) fakeResult {
+		return fakeResult{affected: affected}
+	}, DbMaster)
+	ctx := context.Background()
+	dao := MustNewDao[devAccountEntity](DbMaster)
+
+	account := devAccountEntity{Id: 1, Balance: 100, Version: 3}
+	_, err := dao.UpdateById(ctx, &account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Version != 4 {
+		t.Errorf("version should be increased, got %d", account.Version)
+	}
+	log := dbs[DbMaster].getLog()
+	if log[0] != "update dev_account set `balance` = ?, `version` = `version` + 1 where `id` = ? and `version` = ?" {
+		t.Errorf("update sql got %s", log[0])
+	}
+	if args := dbs[DbMaster].args[0]; !reflect.DeepEqual(args, []interface{}{int64(100), int64(1), int64(3)}) {
+		t.Errorf("update args got %v", args)
+	}
+
+	affected = 0
+	_, err = dao.UpdateById(ctx, &account)
+	if !errors.Is(err, ErrOptimisticLock) {
+		t.Errorf("update conflict should return ErrOptimisticLock, got %v", err)
+	}
+	if account.Version != 4 {
+		t.Errorf("version should not change on conflict, got %d", account.Version)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/jinzhu/copier"
+	"sort"
 )
 
 /*
@@ -52,6 +53,14 @@ func (w *Wrapper) TableName(tableName string) *Wrapper {
 	return w
 }
 
+// TableFromWrapper 使用子查询作为派生表，生成 from (子查询) as alias，设置后TableName不再生效
+// example: TableFromWrapper(GetWrapper().TableName("dev_student").Select("class_id", "count(1) as cn").Group("class_id"), "t")
+func (w *Wrapper) TableFromWrapper(sub *Wrapper, alias string) *Wrapper {
+	w.queryInfo.fromSub = sub
+	w.queryInfo.as = alias
+	return w
+}
+
 func (w *Wrapper) Limit(limit int64) *Wrapper {
 	w.queryInfo.limit = limit
 	return w
@@ -62,6 +71,46 @@ func (w *Wrapper) Page(page int64) *Wrapper {
 	return w
 }
 
+// SearchCount 分页查询(SelectPage)时是否执行count查询总条数（默认为true）
+func (w *Wrapper) SearchCount(searchCount bool) *Wrapper {
+	w.queryInfo.skipCount = !searchCount
+	return w
+}
+
+// CachedTotal 分页查询(SelectPage)时复用已知的总条数，大于0时不再执行count
+// 常用于翻页时由前端回传第一页查询到的总条数
+func (w *Wrapper) CachedTotal(total int64) *Wrapper {
+	w.queryInfo.cachedTotal = total
+	return w
+}
+
+// After 游标分页，查询排在lastValues之后的记录，lastValues为空时查询第一页
+// cursorColumns 为排序字段，可以带上排序方向，example: []string{"create_time desc", "id desc"}
+// 排序(order by)由cursorColumns生成，不能再使用Order，同时Page与Offset不再生效
+func (w *Wrapper) After(cursorColumns []string, lastValues []interface{}) *Wrapper {
+	keyset, err := newKeysetInfo(cursorColumns, lastValues)
+	if err != nil {
+		w.errList = append(w.errList, err)
+		return w
+	}
+	w.queryInfo.keyset = keyset
+	return w
+}
+
+// AfterCursor 游标分页，cursor为上一页查询(SelectByKeyset)返回的游标，为空时查询第一页
+func (w *Wrapper) AfterCursor(cursorColumns []string, cursor string) *Wrapper {
+	var values []interface{}
+	if cursor != "" {
+		var err error
+		values, err = DecodeCursor(cursor)
+		if err != nil {
+			w.errList = append(w.errList, err)
+			return w
+		}
+	}
+	return w.After(cursorColumns, values)
+}
+
 func (w *Wrapper) Offset(offset int64) *Wrapper {
 	w.queryInfo.offset = offset
 	return w
@@ -96,6 +145,28 @@ func (w *Wrapper) Eq(column string, value interface{}) *Wrapper {
 	return w
 }
 
+// AllEq 将map中的每一项转换为等值条件，按字段名排序后拼接，保证生成的SQL是稳定的
+// nullIsNull 为true时，值为nil的字段生成 is null，否则忽略该字段
+func (w *Wrapper) AllEq(params map[string]interface{}, nullIsNull bool) *Wrapper {
+	columns := make([]string, 0, len(params))
+	for column := range params {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	for _, column := range columns {
+		value := params[column]
+		if value == nil {
+			if nullIsNull {
+				w.IsNull(column)
+			}
+			continue
+		}
+		w.Eq(column, value)
+	}
+	return w
+}
+
 func (w *Wrapper) Ne(column string, value interface{}) *Wrapper {
 	item := createWhereItem(column, "!=", value)
 	w.queryInfo.where = append(w.queryInfo.where, item)
@@ -174,12 +245,102 @@ func (w *Wrapper) NotIn(column string, value interface{}) *Wrapper {
 	return w
 }
 
+// InSub 字段 in (子查询)，子查询的表名需要通过 sub.TableName 指定
+// 注意：MySQL不支持在in子查询中使用limit，子查询设置了Limit时生成SQL会返回错误
+// example: InSub("class_id", GetWrapper().TableName("dev_class").Select("id").Eq("grade", 3))
+func (w *Wrapper) InSub(column string, sub *Wrapper) *Wrapper {
+	item := createWhereItem(column, "in", sub)
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
+// NotInSub 字段 not in (子查询)
+func (w *Wrapper) NotInSub(column string, sub *Wrapper) *Wrapper {
+	item := createWhereItem(column, "not in", sub)
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
+// InSql 字段 in (原生SQL子查询)
+// example: InSql("class_id", "select id from dev_class where grade = ?", 3)
+func (w *Wrapper) InSql(column string, sql string, args ...interface{}) *Wrapper {
+	item := createWhereItem(column, "in", rawSql{sql: sql, args: args})
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
+// NotInSql 字段 not in (原生SQL子查询)
+func (w *Wrapper) NotInSql(column string, sql string, args ...interface{}) *Wrapper {
+	item := createWhereItem(column, "not in", rawSql{sql: sql, args: args})
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
+// IsNull 字段 is null
+func (w *Wrapper) IsNull(column string) *Wrapper {
+	item := createWhereItem(column, "is null", nil)
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
+// IsNotNull 字段 is not null
+func (w *Wrapper) IsNotNull(column string) *Wrapper {
+	item := createWhereItem(column, "is not null", nil)
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
+// Exists 拼接 exists (子查询)，子查询的表名需要通过 sub.TableName 指定
+// example: Exists(GetWrapper().TableName("dev_class").Select("1").Apply("dev_class.id = s.class_id"))
+func (w *Wrapper) Exists(sub *Wrapper) *Wrapper {
+	item := createWhereItem("", "exists", sub)
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
+// NotExists 拼接 not exists (子查询)
+func (w *Wrapper) NotExists(sub *Wrapper) *Wrapper {
+	item := createWhereItem("", "not exists", sub)
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
 func (w *Wrapper) Apply(params ...interface{}) *Wrapper {
 	item := createWhereItem("", "apply", params)
 	w.queryInfo.where = append(w.queryInfo.where, item)
 	return w
 }
 
+// Or 拼接 or，下一个查询条件与前面的条件之间使用 or 连接
+// example: Eq("a", 1).Or().Eq("b", 2) => `a` = ? or `b` = ?
+func (w *Wrapper) Or() *Wrapper {
+	item := createWhereItem("", "or", nil)
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
+// And 以 and 拼接一组用括号包裹的嵌套条件
+// example: Eq("a", 1).And(func(w *Wrapper) { w.Eq("b", 2).Or().Eq("c", 3) }) => `a` = ? and (`b` = ? or `c` = ?)
+func (w *Wrapper) And(fn func(w *Wrapper)) *Wrapper {
+	return w.addNested(fn)
+}
+
+// Nested 正常嵌套，不带 and 或者 or，与前后条件的连接方式由 Or() 决定
+// example: Eq("a", 1).Or().Nested(func(w *Wrapper) { w.Gt("b", 2).Lt("c", 3) }) => `a` = ? or (`b` > ? and `c` < ?)
+func (w *Wrapper) Nested(fn func(w *Wrapper)) *Wrapper {
+	return w.addNested(fn)
+}
+
+// addNested 在子Wrapper中构造条件，然后作为一个整体加入当前的查询条件中
+func (w *Wrapper) addNested(fn func(w *Wrapper)) *Wrapper {
+	child := GetWrapper()
+	fn(child)
+	w.errList = append(w.errList, child.errList...)
+	item := createWhereItem("", "nested", child.queryInfo.where)
+	w.queryInfo.where = append(w.queryInfo.where, item)
+	return w
+}
+
 func (w *Wrapper) Where(where []whereItem) *Wrapper {
 	w.queryInfo.where = where
 	return w
@@ -197,6 +358,18 @@ func (w *Wrapper) Join(join string) *Wrapper {
 	return w
 }
 
+// WithDeleted 开启了逻辑删除时，查询包括已删除的所有记录
+func (w *Wrapper) WithDeleted() *Wrapper {
+	w.queryInfo.logicDeleteMode = logicDeleteAll
+	return w
+}
+
+// OnlyDeleted 开启了逻辑删除时，只查询已删除的记录
+func (w *Wrapper) OnlyDeleted() *Wrapper {
+	w.queryInfo.logicDeleteMode = logicDeleteDeleted
+	return w
+}
+
 // QueryUseMaster 查询时强制使用主库（默认为false）
 func (w *Wrapper) QueryUseMaster(useMaster bool) *Wrapper {
 	w.queryInfo.queryUseMaster = useMaster
@@ -229,6 +402,15 @@ func (w *Wrapper) SetExp(column string, value string) *Wrapper {
 	return w
 }
 
+// SetValues 用于Upsert的更新部分，将字段更新为插入的值，生成 `column` = values(`column`)
+func (w *Wrapper) SetValues(columns ...string) *Wrapper {
+	for _, column := range columns {
+		item := dataItem{field: column, op: "values"}
+		w.dataItems = append(w.dataItems, item)
+	}
+	return w
+}
+
 func (w *Wrapper) ToSelectSql() (query string, args []interface{}, err error) {
 	return getSelectSql("", w.queryInfo)
 }
@@ -0,0 +1,196 @@
+package sqlbp
+
+/*
+* 带条件判断的查询条件，condition为false时不会添加对应的条件，用于省去大量的 if 判断
+* 与Mybatis Plus中第一个参数为 boolean condition 的重载函数对应
+* example: GetWrapper().EqIf(name != "", "name", name).InIf(len(ids) > 0, "id", ids)
+ */
+
+func (w *Wrapper) EqIf(condition bool, column string, value interface{}) *Wrapper {
+	if condition {
+		w.Eq(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) NeIf(condition bool, column string, value interface{}) *Wrapper {
+	if condition {
+		w.Ne(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) GtIf(condition bool, column string, value interface{}) *Wrapper {
+	if condition {
+		w.Gt(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) GeIf(condition bool, column string, value interface{}) *Wrapper {
+	if condition {
+		w.Ge(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) LtIf(condition bool, column string, value interface{}) *Wrapper {
+	if condition {
+		w.Lt(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) LeIf(condition bool, column string, value interface{}) *Wrapper {
+	if condition {
+		w.Le(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) BetweenIf(condition bool, column string, start interface{}, end interface{}) *Wrapper {
+	if condition {
+		w.Between(column, start, end)
+	}
+	return w
+}
+
+func (w *Wrapper) NotBetweenIf(condition bool, column string, start interface{}, end interface{}) *Wrapper {
+	if condition {
+		w.NotBetween(column, start, end)
+	}
+	return w
+}
+
+func (w *Wrapper) LikeIf(condition bool, column string, value string) *Wrapper {
+	if condition {
+		w.Like(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) NotLikeIf(condition bool, column string, value string) *Wrapper {
+	if condition {
+		w.NotLike(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) LikeLeftIf(condition bool, column string, value string) *Wrapper {
+	if condition {
+		w.LikeLeft(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) LikeRightIf(condition bool, column string, value string) *Wrapper {
+	if condition {
+		w.LikeRight(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) InIf(condition bool, column string, value interface{}) *Wrapper {
+	if condition {
+		w.In(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) NotInIf(condition bool, column string, value interface{}) *Wrapper {
+	if condition {
+		w.NotIn(column, value)
+	}
+	return w
+}
+
+func (w *Wrapper) InSubIf(condition bool, column string, sub *Wrapper) *Wrapper {
+	if condition {
+		w.InSub(column, sub)
+	}
+	return w
+}
+
+func (w *Wrapper) NotInSubIf(condition bool, column string, sub *Wrapper) *Wrapper {
+	if condition {
+		w.NotInSub(column, sub)
+	}
+	return w
+}
+
+func (w *Wrapper) InSqlIf(condition bool, column string, sql string, args ...interface{}) *Wrapper {
+	if condition {
+		w.InSql(column, sql, args...)
+	}
+	return w
+}
+
+func (w *Wrapper) NotInSqlIf(condition bool, column string, sql string, args ...interface{}) *Wrapper {
+	if condition {
+		w.NotInSql(column, sql, args...)
+	}
+	return w
+}
+
+func (w *Wrapper) IsNullIf(condition bool, column string) *Wrapper {
+	if condition {
+		w.IsNull(column)
+	}
+	return w
+}
+
+func (w *Wrapper) IsNotNullIf(condition bool, column string) *Wrapper {
+	if condition {
+		w.IsNotNull(column)
+	}
+	return w
+}
+
+func (w *Wrapper) ExistsIf(condition bool, sub *Wrapper) *Wrapper {
+	if condition {
+		w.Exists(sub)
+	}
+	return w
+}
+
+func (w *Wrapper) NotExistsIf(condition bool, sub *Wrapper) *Wrapper {
+	if condition {
+		w.NotExists(sub)
+	}
+	return w
+}
+
+func (w *Wrapper) ApplyIf(condition bool, params ...interface{}) *Wrapper {
+	if condition {
+		w.Apply(params...)
+	}
+	return w
+}
+
+func (w *Wrapper) OrIf(condition bool) *Wrapper {
+	if condition {
+		w.Or()
+	}
+	return w
+}
+
+func (w *Wrapper) AndIf(condition bool, fn func(w *Wrapper)) *Wrapper {
+	if condition {
+		w.And(fn)
+	}
+	return w
+}
+
+func (w *Wrapper) NestedIf(condition bool, fn func(w *Wrapper)) *Wrapper {
+	if condition {
+		w.Nested(fn)
+	}
+	return w
+}
+
+func (w *Wrapper) AllEqIf(condition bool, params map[string]interface{}, nullIsNull bool) *Wrapper {
+	if condition {
+		w.AllEq(params, nullIsNull)
+	}
+	return w
+}
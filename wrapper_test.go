@@ -0,0 +1,273 @@
+package sqlbp
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 条件构造器生成SQL的测试，不需要连接数据库
+func TestWrapperSelectSql(t *testing.T) {
+	cases := []struct {
+		name   string
+		w      *Wrapper
+		query  string
+		params []interface{}
+	}{
+		{
+			name:   "or",
+			w:      GetWrapper().Eq("a", 1).Or().Eq("b", 2).Eq("c", 3),
+			query:  "select * from t where `a` = ? or `b` = ? and `c` = ? limit 1024",
+			params: []interface{}{1, 2, 3},
+		},
+		{
+			name: "or_nested",
+			w: GetWrapper().Eq("a", 1).Or().Nested(func(w *Wrapper) {
+				w.Gt("b", 2).Lt("c", 3)
+			}),
+			query:  "select * from t where `a` = ? or (`b` > ? and `c` < ?) limit 1024",
+			params: []interface{}{1, 2, 3},
+		},
+		{
+			name: "and_nested",
+			w: GetWrapper().Eq("a", 1).And(func(w *Wrapper) {
+				w.Eq("b", 2).Or().And(func(w *Wrapper) {
+					w.Eq("c", 3).Eq("d", 4)
+				})
+			}).Eq("e", 5),
+			query:  "select * from t where `a` = ? and (`b` = ? or (`c` = ? and `d` = ?)) and `e` = ? limit 1024",
+			params: []interface{}{1, 2, 3, 4, 5},
+		},
+		{
+			name:   "dangling_or",
+			w:      GetWrapper().Or().Eq("a", 1).Or().Nested(func(w *Wrapper) {}).Eq("b", 2).Or(),
+			query:  "select * from t where `a` = ? and `b` = ? limit 1024",
+			params: []interface{}{1, 2},
+		},
+	}
+
+	for _, c := range cases {
+		query, params, err := c.w.TableName("t").ToSelectSql()
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if query != c.query {
+			t.Errorf("%s: query\n got: %s\nwant: %s", c.name, query, c.query)
+		}
+		if !reflect.DeepEqual(params, c.params) {
+			t.Errorf("%s: params got %v, want %v", c.name, params, c.params)
+		}
+	}
+}
+
+func TestWrapperNullAndExists(t *testing.T) {
+	sub := GetWrapper().TableName("dev_class").Select("1").Apply("dev_class.id = s.class_id").Gt("dev_class.level", 2)
+	w := GetWrapper().TableName("dev_student").As("s").
+		Eq("s.age", 10).
+		IsNull("s.deleted_at").
+		IsNotNull("s.name").
+		Exists(sub).
+		NotExists(GetWrapper().TableName("dev_black").Eq("uid", 7)).
+		Lt("s.id", 100)
+
+	query, params, err := w.ToSelectSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "select * from dev_student s where `s`.`age` = ? and `s`.`deleted_at` is null and `s`.`name` is not null" +
+		" and exists (select 1 from dev_class where (dev_class.id = s.class_id) and `dev_class`.`level` > ?)" +
+		" and not exists (select * from dev_black where `uid` = ?) and `s`.`id` < ? limit 1024"
+	if query != want {
+		t.Errorf("query\n got: %s\nwant: %s", query, want)
+	}
+	if !reflect.DeepEqual(params, []interface{}{10, 2, 7, 100}) {
+		t.Errorf("params got %v", params)
+	}
+
+	_, _, err = GetWrapper().TableName("t").Exists(GetWrapper().Eq("a", 1)).ToSelectSql()
+	if err == nil {
+		t.Errorf("sub query without table name should fail")
+	}
+}
+
+func TestWrapperSubQuery(t *testing.T) {
+	classIds := GetWrapper().TableName("dev_class").Select("id").Eq("grade", 3)
+	w := GetWrapper().TableName("dev_student").
+		Eq("age", 10).
+		InSub("class_id", classIds).
+		NotInSql("id", "select uid from dev_black where level > ?", 5).
+		NotInSub("id", GetWrapper().TableName("dev_leave").Select("uid"))
+
+	query, params, err := w.ToSelectSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "select * from dev_student where `age` = ? and `class_id` in (select id from dev_class where `grade` = ?)" +
+		" and `id` not in (select uid from dev_black where level > ?)" +
+		" and `id` not in (select uid from dev_leave) limit 1024"
+	if query != want {
+		t.Errorf("query\n got: %s\nwant: %s", query, want)
+	}
+	if !reflect.DeepEqual(params, []interface{}{10, 3, 5}) {
+		t.Errorf("params got %v", params)
+	}
+
+	// MySQL不支持in子查询中的limit
+	_, _, err = GetWrapper().TableName("dev_student").
+		InSub("class_id", GetWrapper().TableName("dev_class").Select("id").Limit(10)).ToSelectSql()
+	if err == nil {
+		t.Errorf("in sub query with limit should fail")
+	}
+
+	// 派生表的参数在外层where参数之前
+	sub := GetWrapper().TableName("dev_student").Select("class_id", "count(1) as cn").Gt("age", 18).Group("class_id")
+	w = GetWrapper().TableFromWrapper(sub, "t").Gt("t.cn", 30).Order("t.cn desc")
+	query, params, err = w.ToSelectSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "select * from (select class_id,count(1) as cn from dev_student where `age` > ? group by class_id) as t" +
+		" where `t`.`cn` > ? order by t.cn desc limit 1024"
+	if query != want {
+		t.Errorf("query\n got: %s\nwant: %s", query, want)
+	}
+	if !reflect.DeepEqual(params, []interface{}{18, 30}) {
+		t.Errorf("params got %v", params)
+	}
+
+	_, _, err = GetWrapper().TableFromWrapper(sub, "").ToSelectSql()
+	if err == nil {
+		t.Errorf("derived table without alias should fail")
+	}
+}
+
+func TestWrapperConditionIf(t *testing.T) {
+	name, ids := "", []int64{1, 2}
+	w := GetWrapper().TableName("t").
+		EqIf(name != "", "name", name).
+		InIf(len(ids) > 0, "id", ids).
+		LikeIf(name != "", "title", name).
+		OrIf(name != "").
+		NestedIf(true, func(w *Wrapper) {
+			w.GtIf(false, "age", 1).LeIf(true, "age", 60)
+		}).
+		AllEq(map[string]interface{}{"b": 2, "a": 1, "c": nil, "d": nil}, true).
+		AllEq(map[string]interface{}{"e": nil}, false)
+
+	query, params, err := w.ToSelectSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "select * from t where `id` in (?, ?) and (`age` <= ?) and `a` = ? and `b` = ?" +
+		" and `c` is null and `d` is null limit 1024"
+	if query != want {
+		t.Errorf("query\n got: %s\nwant: %s", query, want)
+	}
+	if !reflect.DeepEqual(params, []interface{}{int64(1), int64(2), 60, 1, 2}) {
+		t.Errorf("params got %v", params)
+	}
+}
+
+func TestCountSql(t *testing.T) {
+	w := GetWrapper().Select("id", "name").Gt("age", 10).Order("id desc").Page(3).Limit(20)
+	query, params, err := getCountSql("dev_student", w.queryInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "select count(1) as cn from dev_student where `age` > ?"; query != want {
+		t.Errorf("query\n got: %s\nwant: %s", query, want)
+	}
+	if !reflect.DeepEqual(params, []interface{}{10}) {
+		t.Errorf("params got %v", params)
+	}
+
+	w = GetWrapper().Select("class_id", "count(1) as n").Gt("age", 10).Group("class_id").Having("n > 5").Order("n desc")
+	query, _, err = getCountSql("dev_student", w.queryInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "select count(1) as cn from (select class_id,count(1) as n from dev_student where `age` > ?" +
+		" group by class_id having n > 5) as sqlbp_count"
+	if query != want {
+		t.Errorf("query\n got: %s\nwant: %s", query, want)
+	}
+
+	page := newPage(nil, w.Page(2).Limit(20).queryInfo)
+	page.setTotal(41)
+	if page.Current != 2 || page.Size != 20 || page.Pages != 3 {
+		t.Errorf("page got %+v", page)
+	}
+}
+
+func TestWrapperKeyset(t *testing.T) {
+	cases := []struct {
+		name   string
+		w      *Wrapper
+		query  string
+		params []interface{}
+	}{
+		{
+			name:   "first_page",
+			w:      GetWrapper().Eq("a", 1).After([]string{"id desc"}, nil).Limit(10),
+			query:  "select * from t where `a` = ? order by `id` desc limit 10",
+			params: []interface{}{1},
+		},
+		{
+			name:   "same_direction",
+			w:      GetWrapper().Eq("a", 1).Or().Eq("b", 2).After([]string{"ctime", "id"}, []interface{}{"2024-01-01", 5}).Page(3),
+			query:  "select * from t where (`a` = ? or `b` = ?) and (`ctime`, `id`) > (?, ?) order by `ctime`, `id` limit 1024",
+			params: []interface{}{1, 2, "2024-01-01", 5},
+		},
+		{
+			name:   "mixed_direction",
+			w:      GetWrapper().After([]string{"score desc", "id asc"}, []interface{}{90, 5}).Limit(20),
+			query:  "select * from t where (`score` < ? or (`score` = ? and `id` > ?)) order by `score` desc, `id` limit 20",
+			params: []interface{}{90, 90, 5},
+		},
+	}
+	for _, c := range cases {
+		query, params, err := c.w.TableName("t").ToSelectSql()
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if query != c.query {
+			t.Errorf("%s: query\n got: %s\nwant: %s", c.name, query, c.query)
+		}
+		if !reflect.DeepEqual(params, c.params) {
+			t.Errorf("%s: params got %v, want %v", c.name, params, c.params)
+		}
+	}
+
+	if _, _, err := GetWrapper().TableName("t").After([]string{"id"}, nil).Order("id").ToSelectSql(); err == nil {
+		t.Errorf("order with keyset should fail")
+	}
+	if err := GetWrapper().After([]string{"id", "age"}, []interface{}{1}).GetError(); err == nil {
+		t.Errorf("values count mismatch should fail")
+	}
+
+	// 游标的编码与解析
+	list := []DevStudentEntity{{Id: 1, Age: 10}, {Id: 7, Age: 18}}
+	keyset, _ := newKeysetInfo([]string{"s.age desc", "id"}, nil)
+	cursor, err := getNextCursor(&list, keyset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := DecodeCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{int64(18), int64(7)}) {
+		t.Errorf("cursor values got %v", values)
+	}
+
+	// 超过2^53的整数不能丢失精度
+	big := []interface{}{int64(1<<53 + 1), uint64(1<<64 - 1), 1.5}
+	cursor, err = EncodeCursor(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, err = DecodeCursor(cursor); err != nil || !reflect.DeepEqual(values, big) {
+		t.Errorf("big cursor values got %v, %v", values, err)
+	}
+}